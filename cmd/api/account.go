@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+// Export everything stored about the current user as a zip archive of JSON files.
+func (app *application) exportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tokens, err := app.models.Tokens.GetAllMetadataForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	apiKeys, err := app.models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// two-factor enrollment status, without the secret
+	var twoFactor any
+	enrollment, err := app.models.TwoFactor.Get(user.ID)
+	switch {
+	case err == nil:
+		twoFactor = map[string]any{"enabled": enrollment.Enabled, "created_at": enrollment.CreatedAt}
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var pendingEmail any
+	email, err := app.models.EmailChanges.Get(user.ID)
+	switch {
+	case err == nil:
+		pendingEmail = email
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", envelope{"user": user, "pending_email_change": pendingEmail}},
+		{"permissions.json", envelope{"permissions": permissions}},
+		{"tokens.json", envelope{"tokens": tokens}},
+		{"api_keys.json", envelope{"api_keys": apiKeys}},
+		{"two_factor.json", envelope{"two_factor": twoFactor}},
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for _, file := range files {
+		js, err := json.MarshalIndent(file.content, "", "\t")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		_, err = f.Write(append(js, '\n'))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="greenlight-export-%d.zip"`, user.ID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// Delete the current user's account and everything that belongs to it. The
+// password, and a two-factor code if enabled, are required again.
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	enabled, err := app.models.TwoFactor.IsEnabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if enabled {
+		valid, err := app.checkTwoFactorCode(user.ID, input.Code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !valid {
+			v.AddError("code", "invalid two-factor authentication code")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.Users.Delete(user, "self-service")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// failed logins are keyed by email address rather than user, so they aren't
+	// removed with the user
+	err = app.models.LoginAttempts.Clear(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Info("user account deleted", "user_id", user.ID)
+
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "account_deleted.tmpl.html", map[string]any{
+			"userID": user.ID,
+		})
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+// create an API key for the current user
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name           string     `json:"name"`
+		Permissions    []string   `json:"permissions"`
+		Expiry         *time.Time `json:"expiry"`
+		OrganizationID *int64     `json:"organization_id"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// A key can only be given permissions the caller currently has. When the
+	// request itself is made with restricted credentials, such as another API key,
+	// those restrictions apply too.
+	allowed, err := app.requestPermissions(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	// A key can be bound to an organization the caller is a member of, which also
+	// lets it hold the codes the caller was granted there. Keys created with
+	// credentials bound to an organization are bound to the same one.
+	bound, err := app.boundOrganization(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if input.OrganizationID == nil && bound != 0 {
+		input.OrganizationID = &bound
+	}
+
+	if input.OrganizationID != nil {
+		membership, err := app.requestMembership(r, *input.OrganizationID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("organization_id", "must be an organization you are a member of")
+		case err != nil:
+			app.serverErrorResponse(w, r, err)
+			return
+		case bound != 0 && bound != *input.OrganizationID:
+			v.AddError("organization_id", "must be the organization your credentials are bound to")
+		default:
+			allowed = append(allowed, membership.Permissions...)
+		}
+	}
+
+	key := &data.APIKey{
+		UserID:         user.ID,
+		Name:           input.Name,
+		Permissions:    input.Permissions,
+		Expiry:         input.Expiry,
+		OrganizationID: input.OrganizationID,
+	}
+
+	if data.ValidateAPIKey(v, key, allowed); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.APIKeys.New(key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/api-keys/%d", key.ID))
+
+	// the plaintext key is only ever returned in this response
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// list the API keys of the current user
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	keys, err := app.models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revoke an API key of the current user
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.APIKeys.Delete(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "API key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
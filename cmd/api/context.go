@@ -9,7 +9,14 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey              = contextKey("user")
+	permissionsContextKey       = contextKey("permissions")
+	apiKeyContextKey            = contextKey("apiKey")
+	boundOrganizationContextKey = contextKey("boundOrganization")
+	organizationContextKey      = contextKey("organization")
+	impersonatorContextKey      = contextKey("impersonator")
+)
 
 // The contextSetUser() method returns a new copy of the request with the provided
 // User struct added to the context.
@@ -27,3 +34,80 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// The contextSetPermissions() method returns a new copy of the request with the
+// permissions granted by the request's credentials added to the context. When set,
+// these are used by requirePermission() instead of the permissions in the database.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// The contextGetPermissions() retrieves the permissions from the request context,
+// if any were set.
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+// The contextSetAPIKey() method returns a new copy of the request with the API key
+// the request was authenticated with added to the context.
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// The contextGetAPIKey() retrieves the API key from the request context, if the
+// request was authenticated with one.
+func (app *application) contextGetAPIKey(r *http.Request) (*data.APIKey, bool) {
+	key, ok := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key, ok
+}
+
+// The contextSetBoundOrganization() method returns a new copy of the request with
+// the ID of the organization its credentials are bound to added to the context, 0
+// if they aren't bound to one.
+func (app *application) contextSetBoundOrganization(r *http.Request, organizationID int64) *http.Request {
+	ctx := context.WithValue(r.Context(), boundOrganizationContextKey, organizationID)
+	return r.WithContext(ctx)
+}
+
+// The contextGetBoundOrganization() retrieves the ID of the organization the
+// request's credentials are bound to, if it is known without a database lookup.
+func (app *application) contextGetBoundOrganization(r *http.Request) (int64, bool) {
+	organizationID, ok := r.Context().Value(boundOrganizationContextKey).(int64)
+	return organizationID, ok
+}
+
+// The contextSetOrganization() method returns a new copy of the request with the
+// user's membership of the request's organization added to the context.
+func (app *application) contextSetOrganization(r *http.Request, membership *data.Membership) *http.Request {
+	ctx := context.WithValue(r.Context(), organizationContextKey, membership)
+	return r.WithContext(ctx)
+}
+
+// The contextGetOrganization() retrieves the membership from the request context.
+// It is only set on routes wrapped by requireOrganization().
+func (app *application) contextGetOrganization(r *http.Request) *data.Membership {
+	membership, ok := r.Context().Value(organizationContextKey).(*data.Membership)
+
+	if !ok {
+		panic("missing organization value in the request context")
+	}
+	return membership
+}
+
+// The contextSetImpersonator() method returns a new copy of the request with the
+// user acting as the request's user added to the context. contextGetUser() keeps
+// returning the impersonated user.
+func (app *application) contextSetImpersonator(r *http.Request, impersonator *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), impersonatorContextKey, impersonator)
+	return r.WithContext(ctx)
+}
+
+// The contextGetImpersonator() retrieves the user acting as the request's user, if
+// the request was made with an impersonation token.
+func (app *application) contextGetImpersonator(r *http.Request) (*data.User, bool) {
+	impersonator, ok := r.Context().Value(impersonatorContextKey).(*data.User)
+	return impersonator, ok
+}
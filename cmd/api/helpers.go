@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/solomonsitotaw23/greenlight/internal/data"
 	"github.com/solomonsitotaw23/greenlight/internal/validator"
 )
 
@@ -29,6 +30,15 @@ func (app *application) readIdParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// Extract the token from an Authorization header in the format "Bearer <token>".
+func (app *application) readBearerToken(r *http.Request) (string, error) {
+	headerParts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return "", errors.New("invalid or missing bearer token")
+	}
+	return headerParts[1], nil
+}
+
 // helper for sending responses this takes the destination http.ResponseWritter and the http status code
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	//Encode the data to json returning error if there was one.
@@ -168,3 +178,26 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// readUserParam() looks up the user named by the "id" URL parameter. If there is
+// no such user, a response has been sent and ok is false.
+func (app *application) readUserParam(w http.ResponseWriter, r *http.Request) (user *data.User, ok bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err = app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+	"github.com/tomasen/realip"
+)
+
+// Issue a time-limited token with which the current user acts as another user.
+// The reason is recorded in the audit trail together with every request made with
+// the token.
+func (app *application) createImpersonationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	actor := app.contextGetUser(r)
+
+	v := validator.New()
+
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	v.Check(user.ID != actor.ID, "user", "must not be yourself")
+	v.Check(!user.Suspended, "user", "must not be suspended")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Impersonating a user mustn't give the actor any permission they don't
+	// already hold.
+	ok, err = app.holdsPermissionsOf(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	token, err := app.models.Tokens.NewImpersonation(user.ID, actor.ID, app.config.tokens.impersonationTTL, realip.FromRequest(r), r.UserAgent())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Audit.Insert(&data.AuditEvent{
+		ActorID: &actor.ID,
+		UserID:  &user.ID,
+		Action:  data.AuditImpersonationStarted,
+		Details: input.Reason,
+		IP:      realip.FromRequest(r),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Info("impersonation started", "impersonator_id", actor.ID, "user_id", user.ID, "reason", input.Reason)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"impersonation_token": token, "user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// End the impersonation the request is made with by revoking its token.
+func (app *application) deleteImpersonationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	impersonator, ok := app.contextGetImpersonator(r)
+	if !ok {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	token, err := app.readBearerToken(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.Delete(data.ScopeImpersonation, token)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Audit.Insert(&data.AuditEvent{
+		ActorID: &impersonator.ID,
+		UserID:  &user.ID,
+		Action:  data.AuditImpersonationEnded,
+		IP:      realip.FromRequest(r),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Info("impersonation ended", "impersonator_id", impersonator.ID, "user_id", user.ID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "impersonation ended"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// list the audit trail, newest first unless sorted otherwise
+func (app *application) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ActorID int
+		UserID  int
+		Action  string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.ActorID = app.readInt(qs, "actor_id", 0, v)
+	input.UserID = app.readInt(qs, "user_id", 0, v)
+	input.Action = app.readString(qs, "action", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.models.Audit.GetAll(int64(input.ActorID), int64(input.UserID), input.Action, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit_events": events, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// holdsPermissionsOf() reports whether the user making the request holds every
+// code the given user holds, globally and in each organization the user is a
+// member of. Membership of an organization counts too, since it opens up the
+// organization's catalog.
+func (app *application) holdsPermissionsOf(r *http.Request, user *data.User) (bool, error) {
+	actorPermissions, err := app.requestPermissions(r)
+	if err != nil {
+		return false, err
+	}
+
+	userPermissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, code := range userPermissions {
+		if !actorPermissions.Include(code) {
+			return false, nil
+		}
+	}
+
+	memberships, err := app.models.Organizations.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, membership := range memberships {
+		actorMembership, err := app.requestMembership(r, membership.Organization.ID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		permissions := append(slices.Clone(actorPermissions), actorMembership.Permissions...)
+
+		for _, code := range membership.Permissions {
+			if !permissions.Include(code) {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
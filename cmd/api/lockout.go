@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/tomasen/realip"
+)
+
+// loginBlockedUntil() returns the time until which logins for email from the
+// client's IP address are refused, or the zero time if they are allowed. Logins
+// are refused while the account is locked, or while the IP address has too many
+// recent failures across all accounts.
+func (app *application) loginBlockedUntil(r *http.Request, email string) (time.Time, error) {
+	until, err := app.models.LoginAttempts.LockedUntil(email)
+	if err != nil || !until.IsZero() {
+		return until, err
+	}
+
+	since := time.Now().Add(-app.config.login.window)
+
+	failures, err := app.models.LoginAttempts.CountFailuresForIP(realip.FromRequest(r), since)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if failures >= app.config.login.maxIPFailures {
+		return time.Now().Add(app.config.login.window), nil
+	}
+
+	return time.Time{}, nil
+}
+
+// recordFailedLogin() records a failed login for email from the client's IP
+// address. Once the account has too many recent failures it is locked, and if it
+// belongs to a user they are notified by email.
+func (app *application) recordFailedLogin(r *http.Request, email string, user *data.User) error {
+	ip := realip.FromRequest(r)
+
+	err := app.models.LoginAttempts.RecordFailure(email, ip)
+	if err != nil {
+		return err
+	}
+
+	failures, err := app.models.LoginAttempts.CountFailuresForEmail(email, time.Now().Add(-app.config.login.window))
+	if err != nil {
+		return err
+	}
+
+	if failures < app.config.login.maxFailures {
+		return nil
+	}
+
+	until := time.Now().Add(app.config.login.lockout)
+
+	err = app.models.LoginAttempts.Lock(email, until)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Warn("account locked after failed logins", "email", email, "ip", ip, "failures", failures)
+
+	if user != nil {
+		app.background(func() {
+			data := map[string]any{
+				"ip":          ip,
+				"lockedUntil": until.UTC().Format(time.RFC1123),
+			}
+
+			err := app.mailer.Send(user.Email, "account_locked.tmpl.html", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		})
+	}
+
+	return nil
+}
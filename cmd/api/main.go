@@ -3,19 +3,30 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"flag"
 	"log/slog"
+	"math"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	_ "github.com/lib/pq" // alias of this import is blank intentionally to stop go compiler from complaining
 	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/jwt"
 	"github.com/solomonsitotaw23/greenlight/internal/mailer"
+	"github.com/solomonsitotaw23/greenlight/internal/oidc"
 )
 
 const version = "1.0.0"
 
+// authentication modes
+const (
+	authModeStateful  = "stateful"  // opaque tokens looked up in the tokens table
+	authModeStateless = "stateless" // signed, self-contained tokens
+)
+
 // configuration setting struct
 type config struct {
 	port int
@@ -33,6 +44,61 @@ type config struct {
 		enable bool    //enable disable rate limiter
 	}
 
+	permissionCache struct {
+		ttl time.Duration //how long the codes of a user are cached, 0 disables the cache
+	}
+
+	tokens struct {
+		authenticationTTL time.Duration //lifetime of access tokens
+		refreshTTL        time.Duration //lifetime of refresh tokens
+		impersonationTTL  time.Duration //lifetime of impersonation tokens
+	}
+
+	organizations struct {
+		defaultSlug string //organization new users join, empty adds them to none
+	}
+
+	magicLink struct {
+		ttl time.Duration //lifetime of magic login tokens
+		url string        //page the emailed link points to, the token is appended as ?token=
+	}
+
+	auth struct {
+		mode         string //stateful | stateless
+		keysDir      string //directory containing the signing keys
+		signingKeyID string //ID (file name without .pem) of the key used for signing
+	}
+
+	login struct {
+		maxFailures   int           //failed logins per account before it is locked
+		maxIPFailures int           //failed logins per IP address before it is blocked
+		window        time.Duration //period in which failed logins are counted
+		lockout       time.Duration //how long an account stays locked
+	}
+
+	password struct {
+		algorithm         string //argon2id | bcrypt
+		argon2Memory      uint   //argon2id memory in KiB
+		argon2Iterations  uint
+		argon2Parallelism uint
+		bcryptCost        int
+	}
+
+	maintenance struct {
+		interval             time.Duration //how often the purge runs, 0 disables it
+		tokenRetention       time.Duration //how long expired tokens are kept
+		unactivatedRetention time.Duration //how long unactivated accounts are kept, 0 keeps them
+		trashRetention       time.Duration //how long deleted movies stay in the trash, 0 keeps them
+	}
+
+	oidc struct {
+		issuer       string //issuer URL of the provider, empty disables single sign-on
+		clientID     string
+		clientSecret string
+		redirectURL  string //where the provider sends the user back to
+		scopes       string //space separated
+	}
+
 	smtp struct {
 		host     string
 		port     int
@@ -48,6 +114,8 @@ type application struct {
 	logger *slog.Logger
 	models data.Models
 	mailer *mailer.Mailer
+	keys   *jwt.KeySet
+	oidc   *oidc.Client
 	wg     sync.WaitGroup
 }
 
@@ -71,6 +139,52 @@ func main() {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enable, "limiter-enable", true, "Enable rate limiter")
 
+	// read permission cache config
+	flag.DurationVar(&cfg.permissionCache.ttl, "permission-cache-ttl", time.Minute, "How long the permission codes of a user are cached (0 disables the cache)")
+
+	// read the organization new users join
+	flag.StringVar(&cfg.organizations.defaultSlug, "default-organization", "", "Slug of an organization new users join (empty adds them to none)")
+
+	// read token lifetimes
+	flag.DurationVar(&cfg.tokens.authenticationTTL, "auth-token-ttl", 15*time.Minute, "Authentication token lifetime")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Refresh token lifetime")
+	flag.DurationVar(&cfg.tokens.impersonationTTL, "impersonation-token-ttl", 30*time.Minute, "Impersonation token lifetime")
+
+	// read magic link login config
+	flag.DurationVar(&cfg.magicLink.ttl, "magic-link-ttl", 15*time.Minute, "Magic login token lifetime")
+	flag.StringVar(&cfg.magicLink.url, "magic-link-url", "", "URL of the page magic login links point to (empty sends the token only)")
+
+	// read authentication mode config
+	flag.StringVar(&cfg.auth.mode, "auth-mode", authModeStateful, "Authentication mode (stateful | stateless); stateless tokens keep the permissions and activation status they were issued with until -auth-token-ttl passes")
+	flag.StringVar(&cfg.auth.keysDir, "auth-keys-dir", "keys", "Directory of Ed25519 PEM keys used in stateless mode")
+	flag.StringVar(&cfg.auth.signingKeyID, "auth-signing-key-id", "", "ID of the key used to sign tokens in stateless mode")
+
+	// read brute-force protection config
+	flag.IntVar(&cfg.login.maxFailures, "login-max-failures", 5, "Failed logins per account before it is locked")
+	flag.IntVar(&cfg.login.maxIPFailures, "login-max-ip-failures", 20, "Failed logins per IP address before it is blocked")
+	flag.DurationVar(&cfg.login.window, "login-failure-window", 15*time.Minute, "Period in which failed logins are counted")
+	flag.DurationVar(&cfg.login.lockout, "login-lockout", 15*time.Minute, "How long an account stays locked")
+
+	// read password hashing config
+	flag.StringVar(&cfg.password.algorithm, "password-algorithm", data.AlgorithmArgon2id, "Password hashing algorithm (argon2id | bcrypt)")
+	flag.UintVar(&cfg.password.argon2Memory, "argon2-memory", 64*1024, "argon2id memory in KiB")
+	flag.UintVar(&cfg.password.argon2Iterations, "argon2-iterations", 3, "argon2id iterations")
+	flag.UintVar(&cfg.password.argon2Parallelism, "argon2-parallelism", 2, "argon2id parallelism")
+	flag.IntVar(&cfg.password.bcryptCost, "bcrypt-cost", 12, "bcrypt cost")
+
+	// read background maintenance config
+	flag.DurationVar(&cfg.maintenance.interval, "maintenance-interval", time.Hour, "Interval of the purge of expired data (0 disables it)")
+	flag.DurationVar(&cfg.maintenance.tokenRetention, "maintenance-token-retention", 24*time.Hour, "How long expired tokens are kept before they are purged")
+	flag.DurationVar(&cfg.maintenance.unactivatedRetention, "maintenance-unactivated-retention", 30*24*time.Hour, "How long unactivated accounts are kept before they are purged (0 keeps them)")
+	flag.DurationVar(&cfg.maintenance.trashRetention, "maintenance-trash-retention", 30*24*time.Hour, "How long deleted movies stay in the trash before they are purged (0 keeps them)")
+
+	// read OpenID Connect provider config
+	flag.StringVar(&cfg.oidc.issuer, "oidc-issuer", "", "OpenID Connect issuer URL (empty disables single sign-on)")
+	flag.StringVar(&cfg.oidc.clientID, "oidc-client-id", "", "OpenID Connect client ID")
+	flag.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", os.Getenv("GREENLIGHT_OIDC_CLIENT_SECRET"), "OpenID Connect client secret")
+	flag.StringVar(&cfg.oidc.redirectURL, "oidc-redirect-url", "http://localhost:4000/v1/oidc/callback", "OpenID Connect redirect URL")
+	flag.StringVar(&cfg.oidc.scopes, "oidc-scopes", "openid email profile", "OpenID Connect scopes")
+
 	// read mailer configs
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
@@ -82,6 +196,29 @@ func main() {
 	// initialize logger
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	// configure how new password hashes are generated
+	switch cfg.password.algorithm {
+	case data.AlgorithmArgon2id, data.AlgorithmBcrypt:
+		// argon2.IDKey() panics on parameters out of these ranges, which would
+		// fail every registration and login instead of the startup
+		if cfg.password.argon2Iterations < 1 || cfg.password.argon2Iterations > math.MaxUint32 ||
+			cfg.password.argon2Parallelism < 1 || cfg.password.argon2Parallelism > math.MaxUint8 ||
+			cfg.password.argon2Memory < 8*cfg.password.argon2Parallelism || cfg.password.argon2Memory > math.MaxUint32 {
+			logger.Error("invalid argon2id parameters, iterations must be at least 1, parallelism between 1 and 255 and memory at least 8 KiB per thread",
+				"memory", cfg.password.argon2Memory, "iterations", cfg.password.argon2Iterations, "parallelism", cfg.password.argon2Parallelism)
+			os.Exit(1)
+		}
+
+		data.PasswordParams.Algorithm = cfg.password.algorithm
+		data.PasswordParams.Memory = uint32(cfg.password.argon2Memory)
+		data.PasswordParams.Iterations = uint32(cfg.password.argon2Iterations)
+		data.PasswordParams.Parallelism = uint8(cfg.password.argon2Parallelism)
+		data.PasswordParams.BcryptCost = cfg.password.bcryptCost
+	default:
+		logger.Error("invalid password algorithm", "algorithm", cfg.password.algorithm)
+		os.Exit(1)
+	}
+
 	// call openDB() helper function to create a connection pool
 	db, err := openDB(cfg)
 	if err != nil {
@@ -98,13 +235,55 @@ func main() {
 		os.Exit(1)
 	}
 
+	models := data.NewModels(db)
+
+	// make sure every known permission code can be granted
+	unknown, err := models.Permissions.Sync(data.KnownPermissions)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if len(unknown) > 0 {
+		logger.Warn("permissions table contains codes missing from the registry", "codes", unknown)
+	}
+
+	// cache permission lookups, and expose how well the cache is doing
+	if cfg.permissionCache.ttl > 0 {
+		cache := data.NewPermissionCache(cfg.permissionCache.ttl)
+		models.UsePermissionCache(cache)
+
+		expvar.Publish("permission_cache", expvar.Func(func() any {
+			return cache.Stats()
+		}))
+	}
+
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
+		models: models,
 		mailer: mailer,
 	}
 
+	// load the signing keys when tokens are signed instead of stored
+	switch cfg.auth.mode {
+	case authModeStateful:
+	case authModeStateless:
+		app.keys, err = jwt.LoadKeySet(cfg.auth.keysDir, cfg.auth.signingKeyID)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	default:
+		logger.Error("invalid auth mode", "mode", cfg.auth.mode)
+		os.Exit(1)
+	}
+
+	// single sign-on is only available when a provider is configured
+	if cfg.oidc.issuer != "" {
+		app.oidc = oidc.New(cfg.oidc.issuer, cfg.oidc.clientID, cfg.oidc.clientSecret, cfg.oidc.redirectURL, strings.Fields(cfg.oidc.scopes))
+	}
+
 	err = app.serve()
 	if err != nil {
 		logger.Error(err.Error())
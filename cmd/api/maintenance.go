@@ -0,0 +1,106 @@
+package main
+
+import (
+	"time"
+)
+
+// key of the advisory lock that makes sure only one API instance at a time runs
+// the maintenance
+const maintenanceLockKey = 0x67726e6c6967 // "grnlig"
+
+// startMaintenance() runs the purge of expired data right away and then at the
+// configured interval, until the returned function is called.
+func (app *application) startMaintenance() (stop func()) {
+	if app.config.maintenance.interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+
+	app.background(func() {
+		ticker := time.NewTicker(app.config.maintenance.interval)
+		defer ticker.Stop()
+
+		for {
+			app.runMaintenance()
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	})
+
+	return func() { close(done) }
+}
+
+// runMaintenance() deletes expired tokens, unfinished single sign-on logins, expired
+// invitations, old failed logins, accounts that were never activated and movies
+// that have been in the trash for too long. Instances that can't get the advisory
+// lock skip the run, another instance is already doing it.
+func (app *application) runMaintenance() {
+	release, acquired, err := app.models.Maintenance.TryLock(maintenanceLockKey)
+	if err != nil {
+		app.logger.Error("maintenance: taking lock", "error", err.Error())
+		return
+	}
+
+	if !acquired {
+		app.logger.Debug("maintenance: skipped, another instance holds the lock")
+		return
+	}
+	defer release()
+
+	now := time.Now()
+
+	tokens, err := app.models.Tokens.DeleteExpired(now.Add(-app.config.maintenance.tokenRetention))
+	if err != nil {
+		app.logger.Error("maintenance: deleting expired tokens", "error", err.Error())
+	} else if len(tokens) > 0 {
+		args := []any{}
+		for scope, count := range tokens {
+			args = append(args, scope, count)
+		}
+		app.logger.Info("maintenance: deleted expired tokens", args...)
+	}
+
+	logins, err := app.models.Identities.DeleteExpiredLogins()
+	if err != nil {
+		app.logger.Error("maintenance: deleting expired oidc logins", "error", err.Error())
+	} else if logins > 0 {
+		app.logger.Info("maintenance: deleted expired oidc logins", "count", logins)
+	}
+
+	invitations, err := app.models.Organizations.DeleteExpiredInvitations()
+	if err != nil {
+		app.logger.Error("maintenance: deleting expired invitations", "error", err.Error())
+	} else if invitations > 0 {
+		app.logger.Info("maintenance: deleted expired invitations", "count", invitations)
+	}
+
+	failures, err := app.models.LoginAttempts.DeleteExpired(now.Add(-app.config.login.window))
+	if err != nil {
+		app.logger.Error("maintenance: deleting old failed logins", "error", err.Error())
+	} else if failures > 0 {
+		app.logger.Info("maintenance: deleted old failed logins", "count", failures)
+	}
+
+	if app.config.maintenance.unactivatedRetention > 0 {
+		ids, err := app.models.Users.DeleteUnactivated(now.Add(-app.config.maintenance.unactivatedRetention))
+		if err != nil {
+			app.logger.Error("maintenance: deleting unactivated users", "error", err.Error())
+		} else if len(ids) > 0 {
+			app.logger.Info("maintenance: deleted unactivated users", "count", len(ids), "ids", ids)
+		}
+	}
+
+	if app.config.maintenance.trashRetention > 0 {
+		movies, err := app.models.Movies.PurgeDeleted(now.Add(-app.config.maintenance.trashRetention))
+		if err != nil {
+			app.logger.Error("maintenance: purging deleted movies", "error", err.Error())
+		} else if movies > 0 {
+			app.logger.Info("maintenance: purged deleted movies", "count", movies)
+		}
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
@@ -93,8 +94,49 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 	})
 }
 
+// how often the last-used time of a single token or API key is written to the database
+const tokenTouchInterval = 5 * time.Minute
+
 // authenticate middleware
 func (app *application) authenticate(next http.Handler) http.Handler {
+	// Record when each credential last had its last-used time written, so that a busy
+	// client causes at most one write per tokenTouchInterval.
+	var (
+		mu      sync.Mutex
+		touched = make(map[string]time.Time)
+	)
+
+	// A background goroutine which removes old entries from the touched map once
+	// every minute.
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			mu.Lock()
+
+			for key, lastTouched := range touched {
+				if time.Since(lastTouched) > tokenTouchInterval {
+					delete(touched, key)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	// shouldTouch() reports whether the last-used time of the credential identified
+	// by key is due to be written, and if so records that it is being written now.
+	shouldTouch := func(key string, now time.Time) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		lastTouched, found := touched[key]
+		if found && now.Sub(lastTouched) <= tokenTouchInterval {
+			return false
+		}
+
+		touched[key] = now
+		return true
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Add the "Vary: Authorization" header to the response. This indicates to any
 		// caches that the response may vary based on the value of the Authorization
@@ -116,15 +158,171 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		// Otherwise, we expect the value of the Authorization header to be in the format
-		// "Bearer <token>".
-		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		// "Bearer <token>". Extract the actual authentication token from it.
+		token, err := app.readBearerToken(r)
+		if err != nil {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		// Extract the actual authentication token from the header parts.
-		token := headerParts[1]
+		// API keys are recognised by their prefix and are accepted in both auth
+		// modes. The request is restricted to the permissions of the key that the
+		// owner still holds.
+		if data.IsAPIKey(token) {
+			v := validator.New()
+
+			if data.ValidateAPIKeyPlaintext(v, token); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			key, err := app.models.APIKeys.GetForKey(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			user, err := app.models.Users.Get(key.UserID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if user.Suspended {
+				app.accountSuspendedResponse(w, r)
+				return
+			}
+
+			ownerPermissions, err := app.models.Permissions.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			now := time.Now()
+			if shouldTouch(fmt.Sprintf("api-key:%d", key.ID), now) {
+				err = app.models.APIKeys.Touch(key.ID, now)
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+
+			var organizationID int64
+			if key.OrganizationID != nil {
+				organizationID = *key.OrganizationID
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetPermissions(r, key.Permissions.Intersect(ownerPermissions))
+			r = app.contextSetAPIKey(r, key)
+			r = app.contextSetBoundOrganization(r, organizationID)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Impersonation tokens let support staff act as another user. They are
+		// looked up in the database in both auth modes, so they can be revoked, and
+		// every request made with one is recorded in the audit trail.
+		if data.IsImpersonationToken(token) {
+			v := validator.New()
+
+			if data.ValidateImpersonationTokenPlaintext(v, token); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			user, impersonatorID, err := app.models.Users.GetForImpersonationToken(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			impersonator, err := app.models.Users.Get(impersonatorID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if user.Suspended || impersonator.Suspended {
+				app.accountSuspendedResponse(w, r)
+				return
+			}
+
+			// the token stops working as soon as the impersonator loses the code
+			permissions, err := app.models.Permissions.GetAllForUser(impersonator.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if !permissions.Include("users:impersonate") {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			err = app.models.Audit.Insert(&data.AuditEvent{
+				ActorID: &impersonator.ID,
+				UserID:  &user.ID,
+				Action:  data.AuditImpersonationRequest,
+				Details: r.Method + " " + r.URL.Path,
+				IP:      realip.FromRequest(r),
+			})
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetImpersonator(r, impersonator)
+			r = app.contextSetBoundOrganization(r, 0)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// In stateless mode the token is signed and carries everything needed to
+		// identify the user, so there is no database lookup.
+		if app.config.auth.mode == authModeStateless {
+			claims, err := app.verifySignedToken(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			// Suspension has to take effect before the token expires, which is the
+			// one thing that is still checked in the database.
+			suspended, err := app.models.Users.IsSuspended(claims.user().ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			if suspended {
+				app.accountSuspendedResponse(w, r)
+				return
+			}
+
+			r = app.contextSetUser(r, claims.user())
+			r = app.contextSetPermissions(r, claims.permissions())
+			r = app.contextSetBoundOrganization(r, claims.Organization)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// validate the token
 		v := validator.New()
 
@@ -144,12 +342,43 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+
+		// Suspended users are turned away even though their tokens are valid.
+		if user.Suspended {
+			app.accountSuspendedResponse(w, r)
+			return
+		}
+
+		// Update the last-used time of the token unless it was already written
+		// recently. A failure here shouldn't fail the request so it is only logged.
+		now := time.Now()
+		if shouldTouch(token, now) {
+			err = app.models.Tokens.Touch(token, now)
+			if err != nil {
+				app.logError(r, err)
+			}
+		}
+
 		// call the context set user method to add the user to the context
 		r = app.contextSetUser(r, user)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// denyImpersonation() refuses requests made with an impersonation token. It
+// guards the routes which change credentials or issue tokens, so support staff
+// acting as a user can look but can't take over the account.
+func (app *application) denyImpersonation(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := app.contextGetImpersonator(r); ok {
+			app.impersonationNotAllowedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
 // requireAuthenticatedUser() middleware to check that a user is not
 // anonymous.
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
@@ -178,12 +407,171 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 	return app.requireAuthenticatedUser(fn)
 }
 
-// require permission
-func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+// requestPermissions() returns the permission codes of the request's user. Those
+// carried by the request's credentials are used if there are any, otherwise they
+// are looked up in the database. On routes scoped to an organization, the codes
+// granted to the user there are added.
+func (app *application) requestPermissions(r *http.Request) (data.Permissions, error) {
+	permissions, ok := app.contextGetPermissions(r)
+	if !ok {
+		var err error
+
+		permissions, err = app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if membership, ok := r.Context().Value(organizationContextKey).(*data.Membership); ok {
+		permissions = append(slices.Clone(permissions), membership.Permissions...)
+	}
+
+	return permissions, nil
+}
+
+// boundOrganization() returns the ID of the organization the request's
+// credentials are bound to, or 0 if they aren't bound to one. Stateful tokens are
+// only looked up here, so requests outside organizations don't pay for it.
+func (app *application) boundOrganization(r *http.Request) (int64, error) {
+	organizationID, ok := app.contextGetBoundOrganization(r)
+	if ok {
+		return organizationID, nil
+	}
+
+	token, err := app.readBearerToken(r)
+	if err != nil {
+		return 0, nil
+	}
+
+	return app.models.Tokens.GetOrganizationID(data.ScopeAuthentication, token)
+}
+
+// requireOrganization() resolves the organization a request acts in and adds the
+// user's membership of it to the context. The organization is taken from the
+// X-Organization-ID header, then from the organization the credentials are bound
+// to, and finally the first one the user joined. Organizations the user isn't a
+// member of are reported as not found, so their existence isn't revealed.
+func (app *application) requireOrganization(next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		organizationID, err := app.boundOrganization(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if header := r.Header.Get("X-Organization-ID"); header != "" {
+			id, err := strconv.ParseInt(header, 10, 64)
+			if err != nil || id < 1 {
+				app.badRequestResponse(w, r, errors.New("invalid X-Organization-ID header"))
+				return
+			}
+
+			// credentials bound to an organization can't be used in another one
+			if organizationID != 0 && organizationID != id {
+				app.notFoundResponse(w, r)
+				return
+			}
+
+			organizationID = id
+		}
+
+		if organizationID == 0 {
+			organizationID, err = app.models.Organizations.GetDefaultForUser(user.ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.organizationRequiredResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		}
+
+		membership, err := app.requestMembership(r, organizationID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetOrganization(r, membership)
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// requireOrganizationParam() works like requireOrganization() for the routes of
+// a single organization, taking the organization from the :id parameter instead.
+func (app *application) requireOrganizationParam(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		organizationID, err := app.readIdParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		bound, err := app.boundOrganization(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if bound != 0 && bound != organizationID {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		membership, err := app.requestMembership(r, organizationID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetOrganization(r, membership)
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// requestMembership() returns the request user's membership of an organization.
+// An API key is restricted to its own codes in the organization too.
+func (app *application) requestMembership(r *http.Request, organizationID int64) (*data.Membership, error) {
+	membership, err := app.models.Organizations.GetMembership(organizationID, app.contextGetUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := app.contextGetAPIKey(r); ok {
+		membership.Permissions = key.Permissions.Intersect(membership.Permissions)
+	}
+
+	return membership, nil
+}
+
+// requirePermission() panics if code isn't in the registry of known permission
+// codes. It is called while the routes are set up, so a typo stops the server from
+// starting instead of denying every request.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	if !data.IsKnownPermission(code) {
+		panic(fmt.Sprintf("requirePermission: unknown permission code %q", code))
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		permissions, err := app.requestPermissions(r)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+// list the versions of a movie, newest first unless sorted otherwise
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-version")
+	filters.SortSafelist = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.Movies.GetRevisions(app.contextGetOrganization(r).Organization.ID, id, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	revision, ok := app.readMovieRevisionParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Compare a revision with another one, given by the "from" query string
+// parameter, which defaults to the revision before it. The first revision stored
+// for a movie has nothing to be compared with, and shows no changes.
+func (app *application) diffMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	to, ok := app.readMovieRevisionParam(w, r)
+	if !ok {
+		return
+	}
+
+	organizationID := app.contextGetOrganization(r).Organization.ID
+
+	var fromRevision *data.MovieRevision
+
+	if r.URL.Query().Has("from") {
+		v := validator.New()
+
+		from := app.readInt(r.URL.Query(), "from", 0, v)
+		v.Check(from >= 1, "from", "must be a version of the movie")
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		fromRevision, err = app.models.Movies.GetRevision(organizationID, id, int32(from))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("from", "must be a version of the movie")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	} else {
+		fromRevision, err = app.models.Movies.GetRevision(organizationID, id, to.Version-1)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			fromRevision = to
+		case err != nil:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	diff := envelope{
+		"from":    fromRevision.Version,
+		"to":      to.Version,
+		"changes": data.DiffMovieRevisions(fromRevision, to),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"diff": diff}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Revert a movie to an earlier revision. The old content is saved as a new
+// version, so the history is kept intact.
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(app.contextGetOrganization(r).Organization.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.requireMovieOwner(w, r, movie) {
+		return
+	}
+
+	revision, ok := app.readMovieRevisionParam(w, r)
+	if !ok {
+		return
+	}
+
+	movie.Title = revision.Title
+	movie.Year = revision.Year
+	movie.Runtime = revision.Runtime
+	movie.Genres = revision.Genres
+
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieRevisionParam() fetches the revision named by the :id and :rev
+// parameters from the current organization's catalog. If it doesn't exist, a
+// response has been sent and ok is false.
+func (app *application) readMovieRevisionParam(w http.ResponseWriter, r *http.Request) (revision *data.MovieRevision, ok bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	version, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("rev"), 10, 32)
+	if err != nil || version < 1 {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	revision, err = app.models.Movies.GetRevision(app.contextGetOrganization(r).Organization.ID, id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return revision, true
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/oidc"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+var errUnverifiedEmail = errors.New("identity provider did not verify the email address")
+
+// Start a login at the configured OpenID Connect provider. The client sends the
+// user to the returned URL, and the provider sends them back to the redirect URL
+// with a code and the state, which are then passed to oidcCallbackHandler.
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	verifier := oidc.NewVerifier()
+
+	login, err := app.models.Identities.NewLogin(verifier, 10*time.Minute)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authorizationURL, err := app.oidc.AuthCodeURL(r.Context(), login.State, login.Nonce, verifier)
+	if err != nil {
+		app.identityProviderErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"authorization_url": authorizationURL, "state": login.State}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Finish a login at the OpenID Connect provider: redeem the code, verify the ID
+// token and issue a token pair for the linked user.
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	// the provider reports a denied or failed login with an error parameter
+	if providerError := qs.Get("error"); providerError != "" {
+		app.logger.Warn("oidc login failed at provider", "error", providerError, "description", qs.Get("error_description"))
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	code := app.readString(qs, "code", "")
+	state := app.readString(qs, "state", "")
+
+	v := validator.New()
+
+	v.Check(code != "", "code", "must be provided")
+	v.Check(state != "", "state", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	login, err := app.models.Identities.ConsumeLogin(state)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("state", "invalid or expired login state")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	claims, err := app.oidc.Exchange(r.Context(), code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrCodeRejected):
+			app.logger.Warn("oidc login rejected", "error", err.Error())
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.identityProviderErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.userForIdentity(claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedEmail):
+			app.errorResponse(w, r, http.StatusForbidden, "your identity provider has not verified your email address")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Two-factor authentication is left to the provider, so the token pair is
+	// issued straight away.
+	authenticationToken, refreshToken, err := app.newTokenPair(r, user, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"authentication_token": authenticationToken,
+		"refresh_token":        refreshToken,
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// userForIdentity() returns the user linked to the provider account in claims.
+// An account that isn't linked yet is linked to the user with the same, verified
+// email address, or to a new user created for it. Either way the user ends up
+// activated, as the provider has already confirmed the address.
+func (app *application) userForIdentity(claims *oidc.Claims) (*data.User, error) {
+	user, err := app.models.Identities.GetUser(claims.Issuer, claims.Subject)
+	if err == nil || !errors.Is(err, data.ErrRecordNotFound) {
+		return user, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err = app.models.Users.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		if !user.Activated {
+			user.Activated = true
+			err = app.models.Users.Update(user)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, data.ErrRecordNotFound):
+		user, err = app.createUserForIdentity(claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = app.models.Identities.Link(user.ID, claims.Issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// createUserForIdentity() creates an activated user without a usable password for
+// a provider account.
+func (app *application) createUserForIdentity(claims *oidc.Claims) (*data.User, error) {
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+
+	// nobody knows this password, it can be replaced through a password reset
+	err := user.Password.Set(rand.Text() + rand.Text())
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.joinDefaultOrganization(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+// codes given to the user who creates an organization
+var organizationCreatorPermissions = data.Permissions{"movies:*", "organizations:admin"}
+
+// how long an invitation to an organization can be accepted
+const organizationInvitationTTL = 7 * 24 * time.Hour
+
+// create an organization with the current user as its first member
+func (app *application) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	organization := &data.Organization{
+		Name: input.Name,
+		Slug: input.Slug,
+	}
+
+	v := validator.New()
+
+	if data.ValidateOrganization(v, organization); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.Insert(organization, app.contextGetUser(r).ID, organizationCreatorPermissions)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "an organization with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	membership := &data.Membership{
+		Organization: *organization,
+		Permissions:  organizationCreatorPermissions,
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/organizations/%d", organization.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"organization": membership}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// list the organizations the current user is a member of
+func (app *application) listOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	memberships, err := app.models.Organizations.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"organizations": memberships}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"organization": app.contextGetOrganization(r)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listOrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
+	members, err := app.models.Organizations.GetMembers(app.contextGetOrganization(r).Organization.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Invite a user, identified by their email address, to an organization. They
+// only become a member once they accept. The response is the same whether or not
+// the address belongs to an account, so it doesn't reveal who is registered.
+func (app *application) inviteOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email       string   `json:"email"`
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidateOrganizationPermissions(v, input.Permissions)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "if an account with this email address exists and isn't a member yet, it has been invited"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	organization := app.contextGetOrganization(r).Organization
+	inviter := app.contextGetUser(r)
+
+	invited, err := app.models.Organizations.Invite(organization.ID, user.ID, inviter.ID, input.Permissions, organizationInvitationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if invited {
+		app.background(func() {
+			err := app.mailer.Send(user.Email, "organization_invitation.tmpl.html", map[string]any{
+				"organizationID":   organization.ID,
+				"organizationName": organization.Name,
+				"inviterName":      inviter.Name,
+			})
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// list the pending invitations of the current user
+func (app *application) listInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations, err := app.models.Organizations.GetInvitationsForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invitations": invitations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// accept an invitation to the organization given by :id
+func (app *application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Organizations.AcceptInvitation(organizationID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	membership, err := app.models.Organizations.GetMembership(organizationID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"organization": membership}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// decline an invitation to the organization given by :id
+func (app *application) declineInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	organizationID, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Organizations.DeclineInvitation(organizationID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "invitation declined"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// replace the codes a member holds in an organization
+func (app *application) updateOrganizationMemberPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("user_id"), 10, 64)
+	if err != nil || userID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateOrganizationPermissions(v, input.Permissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	organizationID := app.contextGetOrganization(r).Organization.ID
+
+	err = app.models.Organizations.SetMemberPermissions(organizationID, userID, input.Permissions)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeOrganizationMembers(w, r, http.StatusOK, organizationID)
+}
+
+func (app *application) removeOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("user_id"), 10, 64)
+	if err != nil || userID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Organizations.RemoveMember(app.contextGetOrganization(r).Organization.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeOrganizationMembers() responds with the members of an organization after
+// they were changed.
+func (app *application) writeOrganizationMembers(w http.ResponseWriter, r *http.Request, status int, organizationID int64) {
+	members, err := app.models.Organizations.GetMembers(organizationID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, status, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Issue a token pair bound to an organization the user is a member of. Requests
+// made with the new tokens act in that organization and can't be switched to
+// another one with the X-Organization-ID header.
+func (app *application) createOrganizationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		OrganizationID int64 `json:"organization_id"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// API keys are bound to an organization when they are created
+	if _, ok := app.contextGetAPIKey(r); ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.OrganizationID > 0, "organization_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	_, err = app.models.Organizations.GetMembership(input.OrganizationID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	authenticationToken, refreshToken, err := app.newTokenPair(r, user, input.OrganizationID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"authentication_token": authenticationToken,
+		"refresh_token":        refreshToken,
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// joinDefaultOrganization() adds a new user to the organization named by the
+// -default-organization flag, if any, so single-team installations can use the
+// movie catalog right away. A missing organization is logged rather than failing
+// the sign-up.
+func (app *application) joinDefaultOrganization(user *data.User) error {
+	if app.config.organizations.defaultSlug == "" {
+		return nil
+	}
+
+	organization, err := app.models.Organizations.GetBySlug(app.config.organizations.defaultSlug)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Warn("default organization doesn't exist", "slug", app.config.organizations.defaultSlug, "user_id", user.ID)
+			return nil
+		}
+		return err
+	}
+
+	err = app.models.Organizations.AddMember(organization.ID, user.ID, nil)
+	if err != nil && !errors.Is(err, data.ErrDuplicateMember) {
+		return err
+	}
+
+	return nil
+}
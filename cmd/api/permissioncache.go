@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+)
+
+// startPermissionCacheListener() listens for the changes to grants announced by
+// the database, including those made through other API instances, and drops the
+// affected entries from the permission cache until the returned function is
+// called.
+func (app *application) startPermissionCacheListener() (stop func()) {
+	cache := app.models.Permissions.Cache
+	if cache == nil {
+		return func() {}
+	}
+
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.Error("permission cache listener", "error", err.Error())
+		}
+	})
+
+	done := make(chan struct{})
+
+	app.background(func() {
+		err := listener.Listen(data.PermissionsChangedChannel)
+		if err != nil {
+			app.logger.Error("permission cache listener", "error", err.Error())
+			return
+		}
+
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case notification := <-listener.Notify:
+				switch {
+				// the connection was re-established, and changes made in the
+				// meantime weren't announced to us
+				case notification == nil:
+					cache.InvalidateAll()
+				case notification.Extra == "*":
+					cache.InvalidateAll()
+				default:
+					userID, err := strconv.ParseInt(notification.Extra, 10, 64)
+					if err != nil {
+						cache.InvalidateAll()
+						continue
+					}
+					cache.Invalidate(userID)
+				}
+			case <-ticker.C:
+				cache.DeleteExpired()
+
+				// make sure a dead connection is noticed and replaced
+				go listener.Ping()
+			case <-done:
+				return
+			}
+		}
+	})
+
+	// closing the listener also stops a Listen() call waiting for a connection
+	return func() {
+		close(done)
+		listener.Close()
+	}
+}
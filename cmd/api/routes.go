@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -15,17 +16,80 @@ func (app *application) routes() http.Handler {
 
 	// routes
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthCheckHandler)
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.requirePermission("metrics:view", expvar.Handler().ServeHTTP))
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requireOrganization(app.requirePermission("movies:read", app.listMoviesHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requireOrganization(app.requirePermission("movies:write", app.createMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requireOrganization(app.requirePermission("movies:read", app.showMovieHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requireOrganization(app.requirePermission("movies:write", app.updateMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requireOrganization(app.requirePermission("movies:write", app.deleteMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requireOrganization(app.requirePermission("movies:read", app.listMovieRevisionsHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:rev", app.requireOrganization(app.requirePermission("movies:read", app.showMovieRevisionHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:rev/diff", app.requireOrganization(app.requirePermission("movies:read", app.diffMovieRevisionsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:rev/revert", app.requireOrganization(app.requirePermission("movies:write", app.revertMovieHandler)))
 
 	// user end point
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.denyImpersonation(app.updateUserPasswordHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.denyImpersonation(app.requireAuthenticatedUser(app.deleteUserHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireAuthenticatedUser(app.exportUserDataHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.denyImpersonation(app.confirmEmailChangeHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.denyImpersonation(app.requireActivatedUser(app.requestEmailChangeHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/invitations", app.requireActivatedUser(app.listInvitationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/invitations/:id/accept", app.denyImpersonation(app.requireActivatedUser(app.acceptInvitationHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/invitations/:id", app.denyImpersonation(app.requireActivatedUser(app.declineInvitationHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.denyImpersonation(app.requireAuthenticatedUser(app.deleteSessionHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireActivatedUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.denyImpersonation(app.requireActivatedUser(app.createAPIKeyHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.denyImpersonation(app.requireActivatedUser(app.deleteAPIKeyHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa", app.denyImpersonation(app.requireAuthenticatedUser(app.enrollTwoFactorHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/2fa", app.denyImpersonation(app.requireAuthenticatedUser(app.confirmTwoFactorHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/2fa", app.denyImpersonation(app.requireAuthenticatedUser(app.disableTwoFactorHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.denyImpersonation(app.createAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/mfa", app.denyImpersonation(app.createTwoFactorAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.denyImpersonation(app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication/all", app.denyImpersonation(app.requireAuthenticatedUser(app.deleteAllAuthenticationTokensHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.denyImpersonation(app.refreshAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.denyImpersonation(app.createPasswordResetTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", app.denyImpersonation(app.createMagicLinkTokenHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/tokens/magic-link", app.denyImpersonation(app.redeemMagicLinkTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/organization", app.denyImpersonation(app.requireActivatedUser(app.createOrganizationTokenHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/impersonation", app.requireAuthenticatedUser(app.deleteImpersonationTokenHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/login", app.denyImpersonation(app.oidcLoginHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/oidc/callback", app.denyImpersonation(app.oidcCallbackHandler))
+
+	// organization end points
+	router.HandlerFunc(http.MethodGet, "/v1/organizations", app.requireActivatedUser(app.listOrganizationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/organizations", app.requireActivatedUser(app.createOrganizationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/organizations/:id", app.requireOrganizationParam(app.showOrganizationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/organizations/:id/members", app.requireOrganizationParam(app.listOrganizationMembersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/organizations/:id/members", app.denyImpersonation(app.requireOrganizationParam(app.requirePermission("organizations:admin", app.inviteOrganizationMemberHandler))))
+	router.HandlerFunc(http.MethodPut, "/v1/organizations/:id/members/:user_id/permissions", app.denyImpersonation(app.requireOrganizationParam(app.requirePermission("organizations:admin", app.updateOrganizationMemberPermissionsHandler))))
+	router.HandlerFunc(http.MethodDelete, "/v1/organizations/:id/members/:user_id", app.denyImpersonation(app.requireOrganizationParam(app.requirePermission("organizations:admin", app.removeOrganizationMemberHandler))))
+
+	// admin end points
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions", app.requirePermission("roles:admin", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/movies/trash", app.requireOrganization(app.requirePermission("movies:admin", app.listDeletedMoviesHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/movies/trash/:id/restore", app.requireOrganization(app.requirePermission("movies:admin", app.restoreMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/movies/trash/:id", app.requireOrganization(app.requirePermission("movies:admin", app.purgeMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("roles:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/roles", app.requirePermission("roles:admin", app.createRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles/:name", app.requirePermission("roles:admin", app.showRoleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/roles/:name", app.requirePermission("roles:admin", app.updateRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/roles/:name", app.requirePermission("roles:admin", app.deleteRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/users/:id", app.requirePermission("users:admin", app.updateUserStatusHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.showUserPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.revokeUserPermissionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/impersonate", app.denyImpersonation(app.requirePermission("users:impersonate", app.createImpersonationTokenHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit-events", app.requirePermission("users:admin", app.listAuditEventsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/roles", app.requirePermission("roles:admin", app.listUserRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("roles:admin", app.addUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:name", app.requirePermission("roles:admin", app.removeUserRoleHandler))
 
 	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
 }
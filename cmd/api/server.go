@@ -24,6 +24,9 @@ func (app *application) serve() error {
 
 	shutdownError := make(chan error)
 
+	stopMaintenance := app.startMaintenance()
+	stopPermissionCacheListener := app.startPermissionCacheListener()
+
 	go func() {
 		// Create a quit channel which carries os.Signal values.
 		quit := make(chan os.Signal, 1)
@@ -44,6 +47,9 @@ func (app *application) serve() error {
 
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
 
+		stopMaintenance()
+		stopPermissionCacheListener()
+
 		app.wg.Wait()
 		shutdownError <- nil
 
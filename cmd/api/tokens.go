@@ -7,6 +7,7 @@ import (
 
 	"github.com/solomonsitotaw23/greenlight/internal/data"
 	"github.com/solomonsitotaw23/greenlight/internal/validator"
+	"github.com/tomasen/realip"
 )
 
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -31,14 +32,33 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Refuse to check the password at all while the account is locked or the
+	// client has made too many failed attempts.
+	until, err := app.loginBlockedUntil(r, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !until.IsZero() {
+		app.loginLockedResponse(w, r, until)
+		return
+	}
+
 	// Lookup the user record based on the email address. If no matching user was
 	// found, then call the app.invalidCredentialsResponse() helper to send a 401
-	// Unauthorized response to the client
+	// Unauthorized response to the client. Failures for unknown addresses are
+	// recorded too, so lockouts don't reveal which accounts exist.
 
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.recordFailedLogin(r, input.Email, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -55,20 +75,268 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	// If the passwords don't match, then call the app.invalidCredentialsResponse()
 	// helper again and return.
 	if !match {
+		err = app.recordFailedLogin(r, user.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	// Otherwise, if the password is correct, generate a new token with a 24-hour
-	// expiry time and the scope 'authentication'.
+	// The password is known to be correct at this point, so if its hash was made
+	// with an outdated algorithm or parameters, replace it. Failing to do so
+	// shouldn't fail the login. Passwords too long for the configured algorithm keep
+	// their hash.
+	if user.Password.NeedsRehash() && len(input.Password) <= data.PasswordParams.MaxLength() {
+		err = user.Password.Set(input.Password)
+		if err == nil {
+			err = app.models.Users.Update(user)
+		}
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+
+	// If the user has two-factor authentication enabled, the password alone isn't
+	// enough. Hand out a short-lived mfa-pending token instead, which can be
+	// exchanged for an authentication token together with a valid code.
+	enabled, err := app.models.TwoFactor.IsEnabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if enabled {
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeMFAPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"mfa_required": true, "mfa_pending_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Otherwise, the login has succeeded, so forget about earlier failures and
+	// generate a new authentication and refresh token pair.
+	err = app.models.LoginAttempts.Clear(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authenticationToken, refreshToken, err := app.newTokenPair(r, user, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"authentication_token": authenticationToken,
+		"refresh_token":        refreshToken,
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newTokenPair() generates a refresh token in a new token family and a short-lived
+// authentication token in the same family. The client's IP address and user agent
+// are stored alongside the tokens so the user can tell their sessions apart. Both
+// tokens are bound to the given organization, unless organizationID is 0.
+func (app *application) newTokenPair(r *http.Request, user *data.User, organizationID int64) (*data.Token, *data.Token, error) {
+	refreshToken, err := app.models.Tokens.NewForClient(user.ID, app.config.tokens.refreshTTL, data.ScopeRefresh, "", organizationID, realip.FromRequest(r), r.UserAgent())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authenticationToken, err := app.newAuthenticationToken(r, user, refreshToken.Family, organizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authenticationToken, refreshToken, nil
+}
+
+// Exchange a refresh token for a new authentication token and a new refresh
+// token. Each refresh token can only be used once.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"refresh_token"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	refreshToken, err := app.models.Tokens.Rotate(input.TokenPlaintext, app.config.tokens.refreshTTL, realip.FromRequest(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			// the whole token family has been revoked at this point
+			app.logger.Warn("refresh token reuse detected", "ip", realip.FromRequest(r))
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(refreshToken.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authenticationToken, err := app.newAuthenticationToken(r, user, refreshToken.Family, refreshToken.OrganizationID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"authentication_token": authenticationToken,
+		"refresh_token":        refreshToken,
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Generate a password reset token and send it to the user's email address. The
+// response is the same whether or not the address belongs to an activated
+// account, so it can't be used to find out which accounts exist.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "if an activated account exists for this address, an email will be sent to it containing password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Only activated accounts are allowed to reset their password.
+	if err != nil || !user.Activated {
+		err = app.writeJSON(w, http.StatusAccepted, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Otherwise, create a new password reset token with a 45-minute expiry time.
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Email the user with their password reset token.
+	app.background(func() {
+		data := map[string]any{
+			"passwordResetToken": token.Plaintext,
+		}
+
+		err = app.mailer.Send(user.Email, "token_password_reset.tmpl.html", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Revoke the authentication token presented in the Authorization header of the
+// request, logging the client out of the current session.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := app.readBearerToken(r)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	// Revoke the refresh token issued together with this token as well, otherwise
+	// the client could simply refresh its way back in. A signed token can't be
+	// revoked itself, but it stops being refreshable once its family is gone.
+	switch app.config.auth.mode {
+	case authModeStateless:
+		err = app.revokeSignedToken(token)
+	default:
+		err = app.models.Tokens.DeleteFamily(data.ScopeAuthentication, token)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "authentication token successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Revoke every authentication and refresh token held by the current user, logging
+// them out of all sessions.
+func (app *application) deleteAllAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeRefresh, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "all authentication tokens successfully revoked"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
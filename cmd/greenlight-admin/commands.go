@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+// scopes of the tokens which are, or can be exchanged for, a session
+var sessionTokenScopes = []string{
+	data.ScopeAuthentication,
+	data.ScopeRefresh,
+	data.ScopeMFAPending,
+	data.ScopeMagicLogin,
+	data.ScopeImpersonation,
+}
+
+func createUserCommand(app *application, args []string) error {
+	fs := flag.NewFlagSet("create-user", flag.ExitOnError)
+	activated := fs.Bool("activated", false, "Create the user already activated")
+	permissions := fs.String("permissions", "movies:read", "Comma separated permission codes to grant")
+	roles := fs.String("roles", "", "Comma separated roles to assign")
+	organization := fs.String("organization", "", "Slug of an organization to add the user to")
+	passwordStdin := fs.Bool("password-stdin", false, "Read the password from the first line of stdin instead of generating one")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return errors.New("expected a name and an email address")
+	}
+
+	user := &data.User{
+		Name:      fs.Arg(0),
+		Email:     fs.Arg(1),
+		Activated: *activated,
+	}
+
+	password, generated, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	codes := splitList(*permissions)
+
+	v := validator.New()
+
+	data.ValidateUser(v, user)
+	validatePermissionCodes(v, codes)
+
+	if !v.Valid() {
+		return validationError(v.Errors)
+	}
+
+	var org *data.Organization
+	if *organization != "" {
+		org, err = app.models.Organizations.GetBySlug(*organization)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return fmt.Errorf("no organization with slug %q", *organization)
+			}
+			return err
+		}
+	}
+
+	names := splitList(*roles)
+	for _, name := range names {
+		_, err = app.models.Roles.Get(name)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return fmt.Errorf("no role named %q", name)
+			}
+			return err
+		}
+	}
+
+	err = app.syncPermissions()
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			return errors.New("a user with this email already exists")
+		}
+		return err
+	}
+
+	if len(codes) > 0 {
+		err = app.models.Permissions.AddForUser(user.ID, codes...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(names) > 0 {
+		err = app.models.Roles.AddForUser(user.ID, names...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if org != nil {
+		err = app.models.Organizations.AddMember(org.ID, user.ID, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("created user %d <%s>\n", user.ID, user.Email)
+	if generated {
+		fmt.Printf("password: %s\n", password)
+	}
+
+	return nil
+}
+
+func listUsersCommand(app *application, args []string) error {
+	fs := flag.NewFlagSet("list-users", flag.ExitOnError)
+	search := fs.String("q", "", "Only list users whose name or email contains this")
+	status := fs.String("status", "", "Only list users with this status (activated | unactivated | suspended)")
+	page := fs.Int("page", 1, "Page to list")
+	pageSize := fs.Int("page-size", 50, "Users per page")
+	sort := fs.String("sort", "id", "Sort by id, name, email or created_at, prefixed by - for descending order")
+	fs.Parse(args)
+
+	filters := data.Filters{
+		Page:         *page,
+		PageSize:     *pageSize,
+		Sort:         *sort,
+		SortSafelist: []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"},
+	}
+
+	v := validator.New()
+
+	data.ValidateFilters(v, filters)
+	v.Check(validator.PermittedValue(*status, "", "activated", "unactivated", "suspended"), "status", "must be activated, unactivated or suspended")
+
+	if !v.Valid() {
+		return validationError(v.Errors)
+	}
+
+	users, metadata, err := app.models.Users.GetAll(*search, *status, filters)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tEMAIL\tACTIVATED\tSUSPENDED\tCREATED")
+	for _, user := range users {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%t\t%s\n", user.ID, user.Name, user.Email, user.Activated, user.Suspended, user.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	tw.Flush()
+
+	if metadata.TotalRecords > 0 {
+		fmt.Printf("\npage %d of %d, %d users\n", metadata.CurrentPage, metadata.LastPage, metadata.TotalRecords)
+	}
+
+	return nil
+}
+
+func grantCommand(app *application, args []string) error {
+	user, codes, err := app.readUserAndCodes(args)
+	if err != nil {
+		return err
+	}
+
+	err = app.syncPermissions()
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Permissions.AddForUser(user.ID, codes...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("granted %s to <%s>\n", strings.Join(codes, ", "), user.Email)
+	return nil
+}
+
+func revokeCommand(app *application, args []string) error {
+	user, codes, err := app.readUserAndCodes(args)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		err = app.models.Permissions.RemoveForUser(user.ID, code)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			fmt.Printf("<%s> wasn't granted %s directly\n", user.Email, code)
+		case err != nil:
+			return err
+		default:
+			fmt.Printf("revoked %s from <%s>\n", code, user.Email)
+		}
+	}
+
+	return nil
+}
+
+// Set a new password, and end the user's sessions and any lockout, as a password
+// reset through the API would.
+func resetPasswordCommand(app *application, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	passwordStdin := fs.Bool("password-stdin", false, "Read the password from the first line of stdin instead of generating one")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("expected an email address")
+	}
+
+	user, err := app.getUser(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	password, generated, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+
+	data.ValidateNewPasswordPlaintext(v, password)
+	data.ValidatePasswordStrength(v, password, user.Name, user.Email)
+
+	if !v.Valid() {
+		return validationError(v.Errors)
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range append([]string{data.ScopePasswordReset}, sessionTokenScopes...) {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = app.models.LoginAttempts.Clear(user.Email)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("reset the password of <%s> and revoked their sessions\n", user.Email)
+	if generated {
+		fmt.Printf("password: %s\n", password)
+	}
+
+	return nil
+}
+
+// Revoke every token of a user that grants, or can be exchanged for, a session.
+// Signed authentication tokens issued in stateless mode stay valid until they
+// expire, but can no longer be refreshed.
+func revokeTokensCommand(app *application, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected an email address")
+	}
+
+	user, err := app.getUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range sessionTokenScopes {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("revoked the tokens of <%s>\n", user.Email)
+	return nil
+}
+
+// syncPermissions() makes sure the codes in the registry exist in the database,
+// which the API otherwise only does when it starts.
+func (app *application) syncPermissions() error {
+	_, err := app.models.Permissions.Sync(data.KnownPermissions)
+	return err
+}
+
+func (app *application) getUser(email string) (*data.User, error) {
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, fmt.Errorf("no user with email %q", email)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// readUserAndCodes() reads the arguments of grant and revoke: an email address
+// followed by permission codes.
+func (app *application) readUserAndCodes(args []string) (*data.User, []string, error) {
+	if len(args) < 2 {
+		return nil, nil, errors.New("expected an email address and at least one permission code")
+	}
+
+	codes := args[1:]
+
+	v := validator.New()
+
+	if validatePermissionCodes(v, codes); !v.Valid() {
+		return nil, nil, validationError(v.Errors)
+	}
+
+	user, err := app.getUser(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, codes, nil
+}
+
+func validatePermissionCodes(v *validator.Validator, codes []string) {
+	for _, code := range codes {
+		v.Check(data.IsKnownPermission(code), "permissions", fmt.Sprintf("must only contain known permission codes, not %q", code))
+	}
+}
+
+// readPassword() reads a password from stdin, or generates a random one if
+// fromStdin is false.
+func readPassword(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		return rand.Text(), true, nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, fmt.Errorf("reading password from stdin: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), false, nil
+}
+
+// splits a comma separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
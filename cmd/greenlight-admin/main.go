@@ -0,0 +1,116 @@
+// Command greenlight-admin lets operators manage users directly against the
+// database, for example to bootstrap the first administrator.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/solomonsitotaw23/greenlight/internal/data"
+)
+
+// dependencies of the commands
+type application struct {
+	models data.Models
+}
+
+// a command takes the arguments following its name
+type command struct {
+	usage string
+	run   func(app *application, args []string) error
+}
+
+var commands = map[string]command{
+	"create-user":    {"create-user [flags] <name> <email>", createUserCommand},
+	"list-users":     {"list-users [flags]", listUsersCommand},
+	"grant":          {"grant <email> <code>...", grantCommand},
+	"revoke":         {"revoke <email> <code>...", revokeCommand},
+	"reset-password": {"reset-password [flags] <email>", resetPasswordCommand},
+	"revoke-tokens":  {"revoke-tokens <email>", revokeTokensCommand},
+}
+
+func main() {
+	var dsn string
+
+	flag.StringVar(&dsn, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	db, err := openDB(dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	app := &application{
+		models: data.NewModels(db),
+	}
+
+	err = cmd.run(app, flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: greenlight-admin [-db-dsn=<dsn>] <command> [arguments]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nThe DSN defaults to $GREENLIGHT_DB_DSN.\n")
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("no database DSN, set -db-dsn or GREENLIGHT_DB_DSN")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// validationError turns the errors of a validator into a single error, with the
+// fields in a stable order.
+func validationError(errs map[string]string) error {
+	fields := make([]string, 0, len(errs))
+	for field, message := range errs {
+		fields = append(fields, fmt.Sprintf("%s %s", field, message))
+	}
+	sort.Strings(fields)
+
+	return fmt.Errorf("invalid input: %s", strings.Join(fields, "; "))
+}
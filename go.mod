@@ -3,11 +3,15 @@ module github.com/solomonsitotaw23/greenlight
 go 1.24.6
 
 require (
-	github.com/julienschmidt/httprouter v1.3.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
-	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce // indirect
-	github.com/wneessen/go-mail v0.7.0 // indirect
-	golang.org/x/crypto v0.42.0 // indirect
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/lib/pq v1.10.9
+	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
+	github.com/wneessen/go-mail v0.7.0
+	golang.org/x/crypto v0.42.0
+	golang.org/x/time v0.13.0
+)
+
+require (
+	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/text v0.29.0 // indirect
-	golang.org/x/time v0.13.0 // indirect
 )
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+// APIKeyPrefix marks bearer credentials which are API keys rather than tokens.
+const APIKeyPrefix = "glk_"
+
+// APIKey is a long-lived credential for service accounts. It is restricted to an
+// explicit subset of its owner's permission codes.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"` // only set when the key is created
+	Hash        []byte      `json:"-"`
+	Prefix      string      `json:"prefix"` // first characters of the key, to help users identify it
+	Permissions Permissions `json:"permissions"`
+	Expiry      *time.Time  `json:"expiry"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+	// organization the key is bound to, nil if none
+	OrganizationID *int64 `json:"organization_id,omitempty"`
+}
+
+// IsAPIKey() reports whether a bearer credential is an API key.
+func IsAPIKey(plaintext string) bool {
+	return strings.HasPrefix(plaintext, APIKeyPrefix)
+}
+
+// ValidateAPIKey checks a new API key against the permissions its creator is
+// allowed to delegate.
+func ValidateAPIKey(v *validator.Validator, key *APIKey, allowed Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range key.Permissions {
+		v.Check(IsKnownPermission(code), "permissions", "must only contain known permission codes")
+		v.Check(allowed.Include(code), "permissions", "must only contain permissions you hold")
+	}
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(IsAPIKey(plaintext), "key", "must be an API key")
+	v.Check(len(plaintext) == len(APIKeyPrefix)+26, "key", "must be 30 bytes long")
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// New() generates a key for the given API key and inserts it, filling in the
+// plaintext and the fields set by the database.
+func (m APIKeyModel) New(key *APIKey) error {
+	key.Plaintext = APIKeyPrefix + rand.Text()
+	key.Prefix = key.Plaintext[:len(APIKeyPrefix)+4]
+
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	query := `
+	INSERT INTO api_keys (user_id, name, hash, prefix, permissions, expiry, organization_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at
+	`
+
+	args := []any{key.UserID, key.Name, key.Hash, key.Prefix, pq.Array(key.Permissions), key.Expiry, key.OrganizationID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetForKey() returns the unexpired API key matching a plaintext key.
+func (m APIKeyModel) GetForKey(plaintext string) (*APIKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+	SELECT id, created_at, user_id, name, prefix, permissions, expiry, last_used_at, organization_id
+	FROM api_keys
+	WHERE hash = $1 AND (expiry IS NULL OR expiry > $2)
+	`
+
+	var key APIKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], time.Now()).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.OrganizationID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// list the API keys of a user, newest first
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+	SELECT id, created_at, user_id, name, prefix, permissions, expiry, last_used_at, organization_id
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Permissions),
+			&key.Expiry,
+			&key.LastUsedAt,
+			&key.OrganizationID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Touch() records that the API key was used at the given time.
+func (m APIKeyModel) Touch(id int64, t time.Time) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = $1
+	WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, t, id)
+	return err
+}
+
+// delete an API key of a user
+func (m APIKeyModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM api_keys
+	WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// audit actions
+const (
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditImpersonationEnded   = "impersonation.ended"
+)
+
+// AuditEvent records something an actor did, on their own behalf or as UserID.
+// The user IDs are nil once the users are deleted.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ActorID   *int64    `json:"actor_id"`
+	UserID    *int64    `json:"user_id"`
+	Action    string    `json:"action"`
+	Details   string    `json:"details,omitempty"`
+	IP        string    `json:"ip"`
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds an event to the audit trail.
+func (m AuditModel) Insert(event *AuditEvent) error {
+	query := `
+	INSERT INTO audit_events (actor_id, user_id, action, details, ip)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+	`
+
+	args := []any{event.ActorID, event.UserID, event.Action, event.Details, event.IP}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+}
+
+// GetAll() returns a page of audit events, optionally narrowed down to an actor, a
+// user acted as, and an action. Zero values match everything.
+func (m AuditModel) GetAll(actorID, userID int64, action string, filters Filters) ([]*AuditEvent, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, actor_id, user_id, action, details, ip
+	FROM audit_events
+	WHERE (actor_id = $1 OR $1 = 0)
+	AND (user_id = $2 OR $2 = 0)
+	AND (action = $3 OR $3 = '')
+	ORDER BY %s %s, id DESC
+	LIMIT $4 OFFSET $5
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{actorID, userID, action, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var event AuditEvent
+
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.CreatedAt,
+			&event.ActorID,
+			&event.UserID,
+			&event.Action,
+			&event.Details,
+			&event.IP,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return events, metadata, nil
+}
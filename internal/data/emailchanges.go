@@ -0,0 +1,69 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EmailChangeModel stores the address a user asked to change their email to,
+// until the change is confirmed from that address.
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+// Set() records the pending email address of a user, replacing any earlier one.
+func (m EmailChangeModel) Set(userID int64, email string) error {
+	query := `
+	INSERT INTO pending_email_changes (user_id, email)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET email = EXCLUDED.email, created_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, email)
+	return err
+}
+
+// get the pending email address of a user
+func (m EmailChangeModel) Get(userID int64) (string, error) {
+	query := `
+	SELECT email
+	FROM pending_email_changes
+	WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var email string
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return email, nil
+}
+
+// delete the pending email address of a user
+func (m EmailChangeModel) Delete(userID int64) error {
+	query := `
+	DELETE FROM pending_email_changes
+	WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,155 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// IdentityModel links users to accounts at external OpenID Connect providers and
+// keeps the state of logins that are in progress at a provider.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// OIDCLogin is a login started at an external provider that hasn't returned yet.
+type OIDCLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+// NewLogin() stores a login with a random state and nonce. Only the hash of the
+// state is stored, it is handed back to the user through the provider.
+func (m IdentityModel) NewLogin(codeVerifier string, ttl time.Duration) (*OIDCLogin, error) {
+	login := &OIDCLogin{
+		State:        rand.Text(),
+		Nonce:        rand.Text(),
+		CodeVerifier: codeVerifier,
+		Expiry:       time.Now().Add(ttl),
+	}
+
+	query := `
+	INSERT INTO oidc_logins (state_hash, nonce, code_verifier, expiry)
+	VALUES ($1, $2, $3, $4)
+	`
+
+	stateHash := sha256.Sum256([]byte(login.State))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, stateHash[:], login.Nonce, login.CodeVerifier, login.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return login, nil
+}
+
+// ConsumeLogin() deletes and returns the unexpired login for a state, so each
+// state can only be used once.
+func (m IdentityModel) ConsumeLogin(state string) (*OIDCLogin, error) {
+	query := `
+	DELETE FROM oidc_logins
+	WHERE state_hash = $1
+	RETURNING nonce, code_verifier, expiry
+	`
+
+	stateHash := sha256.Sum256([]byte(state))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	login := OIDCLogin{State: state}
+
+	err := m.DB.QueryRowContext(ctx, query, stateHash[:]).Scan(&login.Nonce, &login.CodeVerifier, &login.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if time.Now().After(login.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+
+	return &login, nil
+}
+
+// get the user linked to an account at a provider
+func (m IdentityModel) GetUser(issuer, subject string) (*User, error) {
+	query := `
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.version
+	FROM users
+	INNER JOIN user_identities ON users.id = user_identities.user_id
+	WHERE user_identities.issuer = $1
+	AND user_identities.subject = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// link a user to an account at a provider
+func (m IdentityModel) Link(userID int64, issuer, subject string) error {
+	query := `
+	INSERT INTO user_identities (issuer, subject, user_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, issuer, subject, userID)
+	return err
+}
+
+// delete the logins that were never completed before they expired
+func (m IdentityModel) DeleteExpiredLogins() (int64, error) {
+	query := `
+	DELETE FROM oidc_logins
+	WHERE expiry < NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
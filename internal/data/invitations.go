@@ -0,0 +1,197 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Invitation is an offer to join an organization with the given codes, which the
+// invited user can accept or decline until it expires.
+type Invitation struct {
+	Organization Organization `json:"organization"`
+	InvitedBy    *int64       `json:"invited_by"` // nil once the inviting user is deleted
+	Permissions  Permissions  `json:"permissions"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Expiry       time.Time    `json:"expiry"`
+}
+
+// Invite() invites a user to an organization, replacing any pending invitation of
+// theirs to it. It reports false, and invites nobody, if the user is already a
+// member.
+func (m OrganizationModel) Invite(organizationID, userID, invitedBy int64, permissions Permissions, ttl time.Duration) (bool, error) {
+	query := `
+	INSERT INTO organization_invitations (organization_id, user_id, invited_by, permissions, expiry)
+	SELECT $1, $2, $3, $4, $5
+	WHERE NOT EXISTS (SELECT 1 FROM organization_members WHERE organization_id = $1 AND user_id = $2)
+	ON CONFLICT (organization_id, user_id) DO UPDATE
+	SET invited_by = EXCLUDED.invited_by, permissions = EXCLUDED.permissions, created_at = NOW(), expiry = EXCLUDED.expiry
+	`
+
+	args := []any{organizationID, userID, invitedBy, pq.Array(permissions), time.Now().Add(ttl)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// get the pending invitations of a user, newest first
+func (m OrganizationModel) GetInvitationsForUser(userID int64) ([]*Invitation, error) {
+	query := `
+	SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug, organizations.version,
+		organization_invitations.invited_by, organization_invitations.permissions,
+		organization_invitations.created_at, organization_invitations.expiry
+	FROM organization_invitations
+	INNER JOIN organizations ON organizations.id = organization_invitations.organization_id
+	WHERE organization_invitations.user_id = $1 AND organization_invitations.expiry > NOW()
+	ORDER BY organization_invitations.created_at DESC, organizations.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		var invitation Invitation
+
+		err := rows.Scan(
+			&invitation.Organization.ID,
+			&invitation.Organization.CreatedAt,
+			&invitation.Organization.Name,
+			&invitation.Organization.Slug,
+			&invitation.Organization.Version,
+			&invitation.InvitedBy,
+			pq.Array(&invitation.Permissions),
+			&invitation.CreatedAt,
+			&invitation.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, &invitation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// AcceptInvitation() makes a user a member of an organization with the codes they
+// were invited with. ErrRecordNotFound is returned if there is no pending
+// invitation.
+func (m OrganizationModel) AcceptInvitation(organizationID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM organization_invitations
+	WHERE organization_id = $1 AND user_id = $2 AND expiry > NOW()
+	RETURNING permissions
+	`
+
+	var permissions Permissions
+
+	err = tx.QueryRowContext(ctx, query, organizationID, userID).Scan(pq.Array(&permissions))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO organization_members (organization_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM organization_members_permissions WHERE organization_id = $1 AND user_id = $2`, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = setMemberPermissions(ctx, tx, organizationID, userID, permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeclineInvitation() deletes a pending invitation of a user, returning
+// ErrRecordNotFound if there is none.
+func (m OrganizationModel) DeclineInvitation(organizationID, userID int64) error {
+	query := `
+	DELETE FROM organization_invitations
+	WHERE organization_id = $1 AND user_id = $2 AND expiry > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpiredInvitations() deletes the invitations nobody answered in time and
+// returns how many there were.
+func (m OrganizationModel) DeleteExpiredInvitations() (int64, error) {
+	query := `
+	DELETE FROM organization_invitations
+	WHERE expiry < NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
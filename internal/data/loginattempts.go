@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginAttemptModel tracks failed logins per account and per IP address, and the
+// temporary lockouts applied to accounts with too many of them.
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// record a failed login for an email address from an IP address
+func (m LoginAttemptModel) RecordFailure(email, ip string) error {
+	query := `
+	INSERT INTO failed_logins (email, ip)
+	VALUES ($1, $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email, ip)
+	return err
+}
+
+// count the failed logins for an email address since the given time
+func (m LoginAttemptModel) CountFailuresForEmail(email string, since time.Time) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM failed_logins
+	WHERE email = $1 AND created_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, email, since).Scan(&count)
+	return count, err
+}
+
+// count the failed logins from an IP address since the given time
+func (m LoginAttemptModel) CountFailuresForIP(ip string, since time.Time) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM failed_logins
+	WHERE ip = $1 AND created_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, ip, since).Scan(&count)
+	return count, err
+}
+
+// Lock() locks an account until the given time.
+func (m LoginAttemptModel) Lock(email string, until time.Time) error {
+	query := `
+	INSERT INTO login_lockouts (email, locked_until)
+	VALUES ($1, $2)
+	ON CONFLICT (email) DO UPDATE SET locked_until = EXCLUDED.locked_until
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email, until)
+	return err
+}
+
+// LockedUntil() returns the time until which an account is locked, or the zero
+// time if it isn't locked.
+func (m LoginAttemptModel) LockedUntil(email string) (time.Time, error) {
+	query := `
+	SELECT locked_until
+	FROM login_lockouts
+	WHERE email = $1 AND locked_until > $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var until time.Time
+
+	err := m.DB.QueryRowContext(ctx, query, email, time.Now()).Scan(&until)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, nil
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return until, nil
+}
+
+// Clear() removes the failed logins and any lockout of an account, after it has
+// logged in successfully.
+func (m LoginAttemptModel) Clear(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM failed_logins WHERE email = $1`, email)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_lockouts WHERE email = $1`, email)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpired() deletes the failed logins recorded before the given time, which
+// no longer count towards a lockout, and the lockouts that have run out.
+func (m LoginAttemptModel) DeleteExpired(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM failed_logins WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM login_lockouts WHERE locked_until < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
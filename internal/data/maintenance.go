@@ -0,0 +1,48 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+// MaintenanceModel coordinates background maintenance between API instances
+// sharing a database.
+type MaintenanceModel struct {
+	DB *sql.DB
+}
+
+// TryLock() tries to take the session-level Postgres advisory lock with the given
+// key without waiting for it. If the lock was taken, the returned function must be
+// called to release it. The lock lives on a dedicated connection, which is
+// discarded rather than returned to the pool if the lock can't be released, so
+// the lock is never held by accident.
+func (m MaintenanceModel) TryLock(key int64) (release func(), acquired bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Close()
+		return nil, false, err
+	}
+
+	release = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key)
+		if err != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	return release, true, nil
+}
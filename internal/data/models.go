@@ -11,25 +11,68 @@ var (
 )
 
 type Models struct {
-	Movies      MovieModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	APIKeys       APIKeyModel
+	Audit         AuditModel
+	EmailChanges  EmailChangeModel
+	Identities    IdentityModel
+	LoginAttempts LoginAttemptModel
+	Maintenance   MaintenanceModel
+	Movies        MovieModel
+	Organizations OrganizationModel
+	Permissions   PermissionModel
+	Roles         RoleModel
+	Tokens        TokenModel
+	TwoFactor     TwoFactorModel
+	Users         UserModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
+		APIKeys: APIKeyModel{
+			DB: db,
+		},
+		Audit: AuditModel{
+			DB: db,
+		},
+		EmailChanges: EmailChangeModel{
+			DB: db,
+		},
+		Identities: IdentityModel{
+			DB: db,
+		},
+		LoginAttempts: LoginAttemptModel{
+			DB: db,
+		},
+		Maintenance: MaintenanceModel{
+			DB: db,
+		},
 		Movies: MovieModel{
 			DB: db,
 		},
+		Organizations: OrganizationModel{
+			DB: db,
+		},
 		Permissions: PermissionModel{
 			DB: db,
 		},
+		Roles: RoleModel{
+			DB: db,
+		},
 		Users: UserModel{
 			DB: db,
 		},
 		Tokens: TokenModel{
 			DB: db,
 		},
+		TwoFactor: TwoFactorModel{
+			DB: db,
+		},
 	}
 }
+
+// UsePermissionCache() makes the permission and role models cache the codes of
+// users in c.
+func (m *Models) UsePermissionCache(c *PermissionCache) {
+	m.Permissions.Cache = c
+	m.Roles.Cache = c
+}
@@ -0,0 +1,177 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieRevision is a snapshot of a movie as it was at one version.
+type MovieRevision struct {
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy *int64    `json:"created_by"` // ID of the user who made the version, nil if unknown or deleted
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	Runtime   Runtime   `json:"runtime"`
+	Genres    []string  `json:"genres"`
+}
+
+// FieldChange describes how a field of a movie differs between two revisions.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// DiffMovieRevisions() lists the fields which changed from one revision to
+// another, in a fixed order.
+func DiffMovieRevisions(from, to *MovieRevision) []FieldChange {
+	changes := []FieldChange{}
+
+	if from.Title != to.Title {
+		changes = append(changes, FieldChange{"title", from.Title, to.Title})
+	}
+	if from.Year != to.Year {
+		changes = append(changes, FieldChange{"year", from.Year, to.Year})
+	}
+	if from.Runtime != to.Runtime {
+		changes = append(changes, FieldChange{"runtime", from.Runtime, to.Runtime})
+	}
+	if !slices.Equal(from.Genres, to.Genres) {
+		changes = append(changes, FieldChange{"genres", from.Genres, to.Genres})
+	}
+
+	return changes
+}
+
+// insertRevision() records the current state of a movie as the revision of its
+// version.
+func insertRevision(ctx context.Context, tx *sql.Tx, movie *Movie, editedBy *int64) error {
+	query := `
+	INSERT INTO movie_revisions (movie_id, version, created_by, title, year, runtime, genres)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	args := []any{movie.ID, movie.Version, editedBy, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetRevisions() returns a page of the revisions of a movie in an organization's
+// catalog. Movies of other organizations, and movies in the trash, are reported as
+// ErrRecordNotFound.
+func (m MovieModel) GetRevisions(organizationID, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	if movieID < 1 {
+		return nil, Metadata{}, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// a page past the end is empty, so whether the movie exists is checked first
+	var exists bool
+
+	err := m.DB.QueryRowContext(ctx, `
+	SELECT EXISTS (SELECT 1 FROM movies WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL)
+	`, movieID, organizationID).Scan(&exists)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if !exists {
+		return nil, Metadata{}, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), version, created_at, created_by, title, year, runtime, genres
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY %s %s
+	LIMIT $2 OFFSET $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	revisions := []*MovieRevision{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var revision MovieRevision
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.Version,
+			&revision.CreatedAt,
+			&revision.CreatedBy,
+			&revision.Title,
+			&revision.Year,
+			&revision.Runtime,
+			pq.Array(&revision.Genres),
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// get a single revision of a movie in an organization's catalog
+func (m MovieModel) GetRevision(organizationID, movieID int64, version int32) (*MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT movie_revisions.version, movie_revisions.created_at, movie_revisions.created_by,
+		movie_revisions.title, movie_revisions.year, movie_revisions.runtime, movie_revisions.genres
+	FROM movie_revisions
+	INNER JOIN movies ON movies.id = movie_revisions.movie_id
+	WHERE movies.id = $1 AND movies.organization_id = $2 AND movies.deleted_at IS NULL
+	AND movie_revisions.version = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revision MovieRevision
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, organizationID, version).Scan(
+		&revision.Version,
+		&revision.CreatedAt,
+		&revision.CreatedBy,
+		&revision.Title,
+		&revision.Year,
+		&revision.Runtime,
+		pq.Array(&revision.Genres),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
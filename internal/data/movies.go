@@ -19,6 +19,16 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitzero,string"` //movie runtime in minutes
 	Genres    []string  `json:"genres,omitempty"`        //Slice of genres for the movie
 	Version   int32     `json:"version"`                 // starts at 1 and will be incremented each time the movie information is updated
+	CreatedBy *int64    `json:"created_by,omitempty"`    // ID of the user who added the movie, nil if unknown or deleted
+	// organization whose catalog the movie belongs to
+	OrganizationID int64 `json:"-"`
+	// when the movie was moved to the trash, nil if it wasn't
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// check whether the movie was added by the given user
+func (movie *Movie) IsOwnedBy(userID int64) bool {
+	return movie.CreatedBy != nil && *movie.CreatedBy == userID
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -45,39 +55,56 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
-// insert a movie
+// insert a movie, together with the revision of its first version
 func (m MovieModel) Insert(movie *Movie) error {
 	query := `
-	INSERT INTO movies (title,year,runtime,genres)
-	VALUES ($1,$2,$3,$4)
+	INSERT INTO movies (title,year,runtime,genres,created_by,organization_id)
+	VALUES ($1,$2,$3,$4,$5,$6)
 	RETURNING id,created_at,version
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.CreatedBy, movie.OrganizationID}
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, movie, movie.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// fetch a movie
-func (m MovieModel) Get(id int64) (*Movie, error) {
+// fetch a movie from an organization's catalog. Movies of other organizations,
+// and movies in the trash, are reported as ErrRecordNotFound.
+func (m MovieModel) Get(organizationID, id int64) (*Movie, error) {
 
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-	SELECT id, created_at, title, year, runtime, genres, version
+	SELECT id, created_at, title, year, runtime, genres, version, created_by, organization_id
 	FROM movies
-	WHERE id = $1
+	WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL
 	`
 	var movie Movie
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id, organizationID).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
@@ -85,6 +112,8 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.CreatedBy,
+		&movie.OrganizationID,
 	)
 
 	if err != nil {
@@ -98,12 +127,12 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-// update a movie
-func (m MovieModel) Update(movie *Movie) error {
+// update a movie, recording the new version as a revision made by editedBy
+func (m MovieModel) Update(movie *Movie, editedBy int64) error {
 	query := `
 	UPDATE movies
 	SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-	WHERE id = $5 AND version = $6 
+	WHERE id = $5 AND version = $6 AND organization_id = $7 AND deleted_at IS NULL
 	RETURNING version 
  ` // check the version to prevent race condition
 
@@ -114,12 +143,19 @@ func (m MovieModel) Update(movie *Movie) error {
 		pq.Array(movie.Genres),
 		movie.ID,
 		movie.Version,
+		movie.OrganizationID,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -129,25 +165,67 @@ func (m MovieModel) Update(movie *Movie) error {
 		}
 	}
 
-	return nil
+	err = insertRevision(ctx, tx, movie, &editedBy)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete() moves a movie of an organization's catalog to the trash, from where it
+// can be restored until it is purged.
+func (m MovieModel) Delete(organizationID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE movies
+	SET deleted_at = NOW()
+	WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL
+	`
+
+	return m.execForMovie(query, organizationID, id)
 }
 
-// delete a movie
-func (m MovieModel) Delete(id int64) error {
+// restore a movie of an organization's catalog from the trash
+func (m MovieModel) Restore(organizationID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
 
+	query := `
+	UPDATE movies
+	SET deleted_at = NULL
+	WHERE id = $1 AND organization_id = $2 AND deleted_at IS NOT NULL
+	`
+
+	return m.execForMovie(query, organizationID, id)
+}
+
+// Purge() permanently deletes a movie of an organization's catalog. Only movies in
+// the trash can be purged.
+func (m MovieModel) Purge(organizationID, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 	DELETE FROM movies
-	WHERE id = $1
+	WHERE id = $1 AND organization_id = $2 AND deleted_at IS NOT NULL
 	`
 
+	return m.execForMovie(query, organizationID, id)
+}
+
+// execForMovie() runs a statement for a single movie, returning
+// ErrRecordNotFound if it didn't affect any row.
+func (m MovieModel) execForMovie(query string, organizationID, id int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, organizationID)
 	if err != nil {
 		return err
 	}
@@ -164,20 +242,44 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// PurgeDeleted() permanently deletes the movies of every organization which were
+// moved to the trash before the given time, and returns how many there were.
+func (m MovieModel) PurgeDeleted(before time.Time) (int64, error) {
+	query := `
+	DELETE FROM movies
+	WHERE deleted_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetAll() returns a page of an organization's movies matching the title and
+// genres, leaving out those in the trash. If owner is not 0, only the movies added
+// by that user are returned.
+func (m MovieModel) GetAll(organizationID int64, title string, genres []string, owner int64, filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`
-	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, created_by, organization_id
 	FROM movies
-	WHERE (to_tsvector('simple',title) @@ plainto_tsquery('simple',$1) OR $1 = '')
-	AND (genres @> $2 OR $2 = '{}')
+	WHERE organization_id = $1 AND deleted_at IS NULL
+	AND (to_tsvector('simple',title) @@ plainto_tsquery('simple',$2) OR $2 = '')
+	AND (genres @> $3 OR $3 = '{}')
+	AND (created_by = $4 OR $4 = 0)
 	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4
+	LIMIT $5 OFFSET $6
 	`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+	args := []any{organizationID, title, pq.Array(genres), owner, filters.limit(), filters.offset()}
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -199,6 +301,8 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.CreatedBy,
+			&movie.OrganizationID,
 		)
 
 		if err != nil {
@@ -217,3 +321,57 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 	return movies, metadata, nil
 }
+
+// GetAllDeleted() returns a page of the movies in an organization's trash.
+func (m MovieModel) GetAllDeleted(organizationID int64, filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, created_by, organization_id, deleted_at
+	FROM movies
+	WHERE organization_id = $1 AND deleted_at IS NOT NULL
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, organizationID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.CreatedBy,
+			&movie.OrganizationID,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
@@ -0,0 +1,409 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+var (
+	ErrDuplicateSlug   = errors.New("duplicate slug")
+	ErrDuplicateMember = errors.New("duplicate member")
+)
+
+var SlugRX = regexp.MustCompile("^[a-z0-9]+(?:-[a-z0-9]+)*$")
+
+// Organization is a tenant with its own movie catalog.
+type Organization struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Version   int32     `json:"version"`
+}
+
+// Membership is a user's place in an organization, with the permission codes they
+// were granted there.
+type Membership struct {
+	Organization Organization `json:"organization"`
+	Permissions  Permissions  `json:"permissions"`
+}
+
+// Member is a user of an organization as shown to the other members.
+type Member struct {
+	UserID      int64       `json:"user_id"`
+	Name        string      `json:"name"`
+	Email       string      `json:"email"`
+	JoinedAt    time.Time   `json:"joined_at"`
+	Permissions Permissions `json:"permissions"`
+}
+
+func ValidateOrganization(v *validator.Validator, organization *Organization) {
+	v.Check(organization.Name != "", "name", "must be provided")
+	v.Check(len(organization.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(organization.Slug != "", "slug", "must be provided")
+	v.Check(len(organization.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(organization.Slug, SlugRX), "slug", "must only contain lowercase letters, digits and single dashes")
+}
+
+// ValidateOrganizationPermissions() checks the codes granted to a member of an
+// organization. Only movie and organization codes apply within an organization.
+func ValidateOrganizationPermissions(v *validator.Validator, permissions Permissions) {
+	v.Check(permissions != nil, "permissions", "must be provided")
+	v.Check(validator.Unique(permissions), "permissions", "must not contain duplicate values")
+
+	for _, code := range permissions {
+		v.Check(IsKnownPermission(code), "permissions", "must only contain known permission codes")
+		v.Check(strings.HasPrefix(code, "movies:") || strings.HasPrefix(code, "organizations:"), "permissions", "must only contain movie and organization permission codes")
+	}
+}
+
+type OrganizationModel struct {
+	DB *sql.DB
+}
+
+// Insert() creates an organization with its creator as the first member, holding
+// the given codes.
+func (m OrganizationModel) Insert(organization *Organization, creatorID int64, permissions Permissions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO organizations (name, slug)
+	VALUES ($1, $2)
+	RETURNING id, created_at, version
+	`
+
+	err = tx.QueryRowContext(ctx, query, organization.Name, organization.Slug).Scan(&organization.ID, &organization.CreatedAt, &organization.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organizations_slug_key"`:
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO organization_members (organization_id, user_id) VALUES ($1, $2)`, organization.ID, creatorID)
+	if err != nil {
+		return err
+	}
+
+	err = setMemberPermissions(ctx, tx, organization.ID, creatorID, permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// get an organization by its slug
+func (m OrganizationModel) GetBySlug(slug string) (*Organization, error) {
+	query := `
+	SELECT id, created_at, name, slug, version
+	FROM organizations
+	WHERE slug = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var organization Organization
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&organization.ID,
+		&organization.CreatedAt,
+		&organization.Name,
+		&organization.Slug,
+		&organization.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &organization, nil
+}
+
+// GetMembership() returns the organization and the user's codes there. If the
+// user isn't a member, ErrRecordNotFound is returned, just as if the organization
+// didn't exist.
+func (m OrganizationModel) GetMembership(organizationID, userID int64) (*Membership, error) {
+	query := `
+	SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug, organizations.version,
+		COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM organizations
+	INNER JOIN organization_members ON organization_members.organization_id = organizations.id
+	LEFT JOIN organization_members_permissions ON organization_members_permissions.organization_id = organization_members.organization_id
+		AND organization_members_permissions.user_id = organization_members.user_id
+	LEFT JOIN permissions ON permissions.id = organization_members_permissions.permission_id
+	WHERE organizations.id = $1 AND organization_members.user_id = $2
+	GROUP BY organizations.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var membership Membership
+
+	err := m.DB.QueryRowContext(ctx, query, organizationID, userID).Scan(
+		&membership.Organization.ID,
+		&membership.Organization.CreatedAt,
+		&membership.Organization.Name,
+		&membership.Organization.Slug,
+		&membership.Organization.Version,
+		pq.Array(&membership.Permissions),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &membership, nil
+}
+
+// get the memberships of a user, in the order they joined the organizations
+func (m OrganizationModel) GetAllForUser(userID int64) ([]*Membership, error) {
+	query := `
+	SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug, organizations.version,
+		COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM organizations
+	INNER JOIN organization_members ON organization_members.organization_id = organizations.id
+	LEFT JOIN organization_members_permissions ON organization_members_permissions.organization_id = organization_members.organization_id
+		AND organization_members_permissions.user_id = organization_members.user_id
+	LEFT JOIN permissions ON permissions.id = organization_members_permissions.permission_id
+	WHERE organization_members.user_id = $1
+	GROUP BY organizations.id, organization_members.created_at
+	ORDER BY organization_members.created_at, organizations.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []*Membership{}
+
+	for rows.Next() {
+		var membership Membership
+
+		err := rows.Scan(
+			&membership.Organization.ID,
+			&membership.Organization.CreatedAt,
+			&membership.Organization.Name,
+			&membership.Organization.Slug,
+			&membership.Organization.Version,
+			pq.Array(&membership.Permissions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		memberships = append(memberships, &membership)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// GetDefaultForUser() returns the ID of the organization a user joined first,
+// which is used when a request doesn't select one.
+func (m OrganizationModel) GetDefaultForUser(userID int64) (int64, error) {
+	query := `
+	SELECT organization_id
+	FROM organization_members
+	WHERE user_id = $1
+	ORDER BY created_at, organization_id
+	LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var organizationID int64
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&organizationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return organizationID, nil
+}
+
+// get the members of an organization with their codes there
+func (m OrganizationModel) GetMembers(organizationID int64) ([]*Member, error) {
+	query := `
+	SELECT users.id, users.name, users.email, organization_members.created_at,
+		COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM organization_members
+	INNER JOIN users ON users.id = organization_members.user_id
+	LEFT JOIN organization_members_permissions ON organization_members_permissions.organization_id = organization_members.organization_id
+		AND organization_members_permissions.user_id = organization_members.user_id
+	LEFT JOIN permissions ON permissions.id = organization_members_permissions.permission_id
+	WHERE organization_members.organization_id = $1
+	GROUP BY users.id, organization_members.created_at
+	ORDER BY organization_members.created_at, users.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+
+	for rows.Next() {
+		var member Member
+
+		err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.JoinedAt, pq.Array(&member.Permissions))
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// AddMember() adds a user to an organization with the given codes.
+func (m OrganizationModel) AddMember(organizationID, userID int64, permissions Permissions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO organization_members (organization_id, user_id) VALUES ($1, $2)`, organizationID, userID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organization_members_pkey"`:
+			return ErrDuplicateMember
+		default:
+			return err
+		}
+	}
+
+	err = setMemberPermissions(ctx, tx, organizationID, userID, permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetMemberPermissions() replaces the codes of a member of an organization.
+func (m OrganizationModel) SetMemberPermissions(organizationID, userID int64, permissions Permissions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM organization_members WHERE organization_id = $1 AND user_id = $2 FOR UPDATE)`, organizationID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM organization_members_permissions WHERE organization_id = $1 AND user_id = $2`, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = setMemberPermissions(ctx, tx, organizationID, userID, permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setMemberPermissions(ctx context.Context, tx *sql.Tx, organizationID, userID int64, permissions Permissions) error {
+	query := `
+	INSERT INTO organization_members_permissions
+	SELECT $1, $2, permissions.id FROM permissions WHERE permissions.code = ANY($3)
+	`
+
+	_, err := tx.ExecContext(ctx, query, organizationID, userID, pq.Array(permissions))
+	return err
+}
+
+// remove a user from an organization, together with their codes there
+func (m OrganizationModel) RemoveMember(organizationID, userID int64) error {
+	query := `
+	DELETE FROM organization_members
+	WHERE organization_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
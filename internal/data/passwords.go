@@ -0,0 +1,225 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// supported password hashing algorithms
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHashParams controls how new password hashes are generated. Hashes
+// generated with other parameters, or with another algorithm, still verify but are
+// reported by NeedsRehash().
+type PasswordHashParams struct {
+	Algorithm string
+
+	// argon2id parameters
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+
+	// bcrypt parameters
+	BcryptCost int
+}
+
+// PasswordParams holds the parameters used for new password hashes. It is meant to
+// be set once at startup, before any request is served.
+var PasswordParams = PasswordHashParams{
+	Algorithm:   AlgorithmArgon2id,
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+	BcryptCost:  12,
+}
+
+// the longest password any algorithm accepts
+const maxPasswordLength = 256
+
+// MaxLength() returns the longest password that can be hashed with the params.
+// bcrypt ignores everything after the first 72 bytes of a password.
+func (params PasswordHashParams) MaxLength() int {
+	if params.Algorithm == AlgorithmBcrypt {
+		return 72
+	}
+	return maxPasswordLength
+}
+
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+// The Set() method hashes a plaintext password with the algorithm and parameters
+// in PasswordParams, and stores both the hash and the plaintext versions in the
+// struct. Hashes are self-describing: bcrypt hashes use the usual "$2a$" format
+// and argon2id hashes use the PHC string format.
+func (p *password) Set(plaintextPassword string) error {
+	var (
+		hash []byte
+		err  error
+	)
+
+	switch PasswordParams.Algorithm {
+	case AlgorithmBcrypt:
+		hash, err = bcrypt.GenerateFromPassword([]byte(plaintextPassword), PasswordParams.BcryptCost)
+	case AlgorithmArgon2id:
+		hash, err = hashArgon2id(plaintextPassword, PasswordParams)
+	default:
+		err = fmt.Errorf("unsupported password hashing algorithm %q", PasswordParams.Algorithm)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintextPassword
+	p.hash = hash
+
+	return nil
+}
+
+// The Matches() method checks whether the provided plaintext password matches the
+// hashed password stored in the struct, returning true if it matches and false
+// otherwise.
+func (p *password) Matches(plaintextPassword string) (bool, error) {
+	switch {
+	case isArgon2idHash(p.hash):
+		params, salt, key, err := decodeArgon2idHash(p.hash)
+		if err != nil {
+			return false, err
+		}
+
+		otherKey := argon2.IDKey([]byte(plaintextPassword), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+		return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+	case isBcryptHash(p.hash):
+		err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+		if err != nil {
+			switch {
+			case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+				return false, nil
+			default:
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		return false, ErrUnknownPasswordHash
+	}
+}
+
+// The NeedsRehash() method reports whether the stored hash was generated with a
+// different algorithm or weaker parameters than PasswordParams, in which case it
+// should be replaced the next time the plaintext password is known.
+func (p *password) NeedsRehash() bool {
+	switch PasswordParams.Algorithm {
+	case AlgorithmArgon2id:
+		if !isArgon2idHash(p.hash) {
+			return true
+		}
+
+		params, salt, key, err := decodeArgon2idHash(p.hash)
+		if err != nil {
+			return true
+		}
+
+		return params.Memory != PasswordParams.Memory ||
+			params.Iterations != PasswordParams.Iterations ||
+			params.Parallelism != PasswordParams.Parallelism ||
+			uint32(len(salt)) != PasswordParams.SaltLength ||
+			uint32(len(key)) != PasswordParams.KeyLength
+	case AlgorithmBcrypt:
+		if !isBcryptHash(p.hash) {
+			return true
+		}
+
+		cost, err := bcrypt.Cost(p.hash)
+		return err != nil || cost != PasswordParams.BcryptCost
+	default:
+		return false
+	}
+}
+
+func isArgon2idHash(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$argon2id$")
+}
+
+func isBcryptHash(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$2")
+}
+
+// hashArgon2id() returns the PHC string for an argon2id hash of a password, in
+// the form $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+func hashArgon2id(plaintextPassword string, params PasswordHashParams) ([]byte, error) {
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintextPassword), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	encoded := fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+// decodeArgon2idHash() parses a PHC string produced by hashArgon2id().
+func decodeArgon2idHash(hash []byte) (PasswordHashParams, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return PasswordHashParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return PasswordHashParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	params := PasswordHashParams{Algorithm: AlgorithmArgon2id}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return PasswordHashParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return PasswordHashParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return PasswordHashParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+// minPasswordEntropy is the minimum estimated strength, in bits, of a new password.
+// It rejects, for example, eight lower-case letters but accepts nine.
+const minPasswordEntropy = 40
+
+// A gzip-compressed, newline-separated list of common and breached passwords in
+// lower case, shipped inside the binary so checks work offline. It is built by
+// wordlists/generate.go, which merges further lists into it.
+//
+//go:embed "wordlists/common_passwords.txt.gz"
+var commonPasswordsGz []byte
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]bool
+)
+
+// ValidatePasswordStrength() checks a new password, chosen by the user with the
+// given name and email address, for strength. It is applied whenever a password is
+// set, but not when logging in with an existing one.
+func ValidatePasswordStrength(v *validator.Validator, password, name, email string) {
+	v.Check(!IsCommonPassword(password), "password", "is too common, please choose a less predictable password")
+	v.Check(!containsPersonalInfo(password, name, email), "password", "must not contain your name or email address")
+	v.Check(PasswordEntropy(password) >= minPasswordEntropy, "password", "is too weak, use a longer password or mix letters, numbers and symbols")
+}
+
+// IsCommonPassword() reports whether a password, or the same password with common
+// letter substitutions undone, is in the bundled list of common passwords.
+func IsCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(loadCommonPasswords)
+
+	lower := strings.ToLower(password)
+	return commonPasswords[lower] || commonPasswords[unleet(lower)]
+}
+
+func loadCommonPasswords() {
+	commonPasswords = make(map[string]bool)
+
+	zr, err := gzip.NewReader(bytes.NewReader(commonPasswordsGz))
+	if err != nil {
+		panic("invalid common passwords list: " + err.Error())
+	}
+	defer zr.Close()
+
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			commonPasswords[line] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		panic("invalid common passwords list: " + err.Error())
+	}
+}
+
+// undo the most common "leetspeak" substitutions
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+func unleet(s string) string {
+	return leetReplacer.Replace(s)
+}
+
+// containsPersonalInfo() reports whether the password contains the user's name,
+// any part of it, or the local part of their email address. Parts shorter than
+// three characters are ignored.
+func containsPersonalInfo(password, name, email string) bool {
+	lower := strings.ToLower(password)
+	candidates := []string{unleet(lower), lower}
+
+	parts := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	if local, _, found := strings.Cut(strings.ToLower(email), "@"); found {
+		parts = append(parts, local)
+	}
+
+	for _, part := range parts {
+		if len(part) < 3 {
+			continue
+		}
+		for _, candidate := range candidates {
+			if strings.Contains(candidate, part) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// PasswordEntropy() estimates the strength of a password in bits. It multiplies
+// the log2 of the size of the character classes used by an effective length in
+// which repeated characters and runs such as "abc" or "123" count for little.
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	poolSize := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			poolSize += class.size
+		}
+	}
+
+	if poolSize == 0 {
+		return 0
+	}
+
+	return effectiveLength(password) * math.Log2(float64(poolSize))
+}
+
+// effectiveLength() counts a character fully unless it repeats the previous one
+// or continues an ascending or descending run, in which case it counts a quarter.
+func effectiveLength(password string) float64 {
+	runes := []rune(strings.ToLower(password))
+
+	length := 0.0
+	for i, r := range runes {
+		if i > 0 {
+			delta := r - runes[i-1]
+			if delta == 0 || delta == 1 || delta == -1 {
+				length += 0.25
+				continue
+			}
+		}
+		length++
+	}
+
+	return length
+}
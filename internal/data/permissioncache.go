@@ -0,0 +1,127 @@
+package data
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PermissionCache keeps the permission codes of users in memory for a while, so
+// they don't have to be looked up on every request. Entries are dropped when the
+// user's grants change, and all of them when a role changes.
+type PermissionCache struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	entries    map[int64]permissionCacheEntry
+	generation uint64 // incremented by every invalidation
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type permissionCacheEntry struct {
+	permissions Permissions
+	expiry      time.Time
+}
+
+// PermissionCacheStats holds the counters exposed for monitoring.
+type PermissionCacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+func NewPermissionCache(ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		ttl:     ttl,
+		entries: make(map[int64]permissionCacheEntry),
+	}
+}
+
+// Get() returns a copy of the cached codes of a user, if there are any that
+// haven't expired, and counts the hit or miss.
+func (c *PermissionCache) Get(userID int64) (Permissions, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[userID]
+	if !found || time.Now().After(entry.expiry) {
+		delete(c.entries, userID)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return slices.Clone(entry.permissions), true
+}
+
+// Generation() returns a number which changes whenever entries are invalidated.
+// It is taken before the codes of a user are looked up and passed to Set().
+func (c *PermissionCache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// Set() caches the codes of a user, unless entries were invalidated since the
+// given generation. The codes might have been read before the change that caused
+// the invalidation, and caching them would undo it.
+func (c *PermissionCache) Set(userID int64, permissions Permissions, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.entries[userID] = permissionCacheEntry{
+		permissions: slices.Clone(permissions),
+		expiry:      time.Now().Add(c.ttl),
+	}
+}
+
+// drop the cached codes of a user
+func (c *PermissionCache) Invalidate(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+	c.generation++
+}
+
+// drop the cached codes of all users
+func (c *PermissionCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	c.generation++
+}
+
+// remove the entries which have expired
+func (c *PermissionCache) DeleteExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for userID, entry := range c.entries {
+		if now.After(entry.expiry) {
+			delete(c.entries, userID)
+		}
+	}
+}
+
+func (c *PermissionCache) Stats() PermissionCacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return PermissionCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
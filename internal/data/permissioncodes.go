@@ -0,0 +1,49 @@
+package data
+
+import (
+	"slices"
+	"strings"
+)
+
+// PermissionDefinition describes a permission code the application knows about.
+type PermissionDefinition struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// KnownPermissions is the registry of every permission code. It is synced to the
+// permissions table at startup, and only codes listed here can be granted or
+// checked. A code ending in "*" grants every code starting with what comes before
+// it.
+var KnownPermissions = []PermissionDefinition{
+	{"*", "All permissions"},
+	{"metrics:view", "Read the runtime metrics at /debug/vars"},
+	{"movies:*", "All movie permissions"},
+	{"movies:read", "Browse movies"},
+	{"movies:write", "Add movies, and change and delete the movies you added"},
+	{"movies:admin", "Change and delete any movie"},
+	{"organizations:*", "All organization permissions"},
+	{"organizations:admin", "Manage the members of an organization and their permission codes"},
+	{"roles:*", "All role permissions"},
+	{"roles:admin", "Manage roles and assign them to users"},
+	{"users:*", "All user permissions"},
+	{"users:admin", "Manage users and their permission codes"},
+	{"users:impersonate", "Act as another user with an impersonation token"},
+}
+
+// check whether the code is in the registry of known permission codes
+func IsKnownPermission(code string) bool {
+	return slices.ContainsFunc(KnownPermissions, func(definition PermissionDefinition) bool {
+		return definition.Code == code
+	})
+}
+
+// check whether the granted code, which may be a wildcard, implies the given code
+func permissionImplies(granted, code string) bool {
+	prefix, isWildcard := strings.CutSuffix(granted, "*")
+	if !isWildcard {
+		return granted == code
+	}
+
+	return strings.HasPrefix(code, prefix)
+}
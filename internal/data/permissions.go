@@ -11,23 +11,66 @@ import (
 
 type Permissions []string
 
-// check whether the permissions slice contains a specific permission code
+// check whether the permissions slice contains a specific permission code, either
+// as is or through a wildcard such as "movies:*" or "*"
 func (p Permissions) Include(code string) bool {
-	return slices.Contains(p, code)
+	return slices.ContainsFunc(p, func(granted string) bool {
+		return permissionImplies(granted, code)
+	})
 }
 
-// Define the PermissionModel type
+// return the codes which are included in both p and other, so that a wildcard in
+// one of them is narrowed down to the codes of the other
+func (p Permissions) Intersect(other Permissions) Permissions {
+	permissions := Permissions{}
+
+	for _, code := range p {
+		if other.Include(code) && !slices.Contains(permissions, code) {
+			permissions = append(permissions, code)
+		}
+	}
+	for _, code := range other {
+		if p.Include(code) && !slices.Contains(permissions, code) {
+			permissions = append(permissions, code)
+		}
+	}
+	return permissions
+}
+
+// Channel on which the database announces changes to grants. The payload is the
+// ID of the user whose codes changed, or "*" when a role changed.
+const PermissionsChangedChannel = "permissions_changed"
+
+// Define the PermissionModel type. If Cache is set, the codes of users are looked
+// up there first.
 type PermissionModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *PermissionCache
 }
 
+// GetAllForUser() returns the codes granted to the user directly, together with
+// the codes of the roles the user has.
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	var generation uint64
+
+	if m.Cache != nil {
+		if permissions, found := m.Cache.Get(userID); found {
+			return permissions, nil
+		}
+		generation = m.Cache.Generation()
+	}
+
 	query := `
 	SELECT permissions.code
 	FROM permissions 
 	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-	INNER JOIN users ON users_permissions.user_id = users.id
-	WHERE users.id = $1
+	WHERE users_permissions.user_id = $1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+	WHERE users_roles.user_id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -55,6 +98,10 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 		return nil, err
 	}
 
+	if m.Cache != nil {
+		m.Cache.Set(userID, permissions, generation)
+	}
+
 	return permissions, nil
 }
 
@@ -62,11 +109,146 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 	INSERT INTO users_permissions
 	SELECT $1,permissions.id FROM permissions WHERE permissions.code=ANY($2)
+	ON CONFLICT DO NOTHING
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
+	if err != nil {
+		return err
+	}
+
+	if m.Cache != nil {
+		m.Cache.Invalidate(userID)
+	}
+
+	return nil
+}
+
+// get the codes granted to the user directly, leaving out those of their roles
+func (m PermissionModel) GetDirectForUser(userID int64) (Permissions, error) {
+	query := `
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+	WHERE users_permissions.user_id = $1
+	ORDER BY permissions.code
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// revoke a code granted to the user directly
+func (m PermissionModel) RemoveForUser(userID int64, code string) error {
+	query := `
+	DELETE FROM users_permissions
+	USING permissions
+	WHERE users_permissions.permission_id = permissions.id
+	AND users_permissions.user_id = $1
+	AND permissions.code = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	if m.Cache != nil {
+		m.Cache.Invalidate(userID)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Sync() adds the codes of the registry to the permissions table and updates their
+// descriptions. Codes in the table which aren't in the registry are left alone, as
+// they may still be granted to users, and are returned so they can be reported.
+func (m PermissionModel) Sync(definitions []PermissionDefinition) ([]string, error) {
+	codes := make([]string, len(definitions))
+	descriptions := make([]string, len(definitions))
+	for i, definition := range definitions {
+		codes[i] = definition.Code
+		descriptions[i] = definition.Description
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+	INSERT INTO permissions (code, description)
+	SELECT * FROM unnest($1::text[], $2::text[])
+	ON CONFLICT (code) DO UPDATE SET description = EXCLUDED.description
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(codes), pq.Array(descriptions))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT code
+	FROM permissions
+	WHERE NOT code = ANY($1)
+	ORDER BY code
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unknown := []string{}
+
+	for rows.Next() {
+		var code string
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, code)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
 }
@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/solomonsitotaw23/greenlight/internal/validator"
@@ -13,6 +15,20 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeMFAPending     = "mfa-pending"
+	ScopeEmailChange    = "email-change"
+	ScopeMagicLogin     = "magic-login"
+	ScopeImpersonation  = "impersonation"
+)
+
+// ImpersonationTokenPrefix marks bearer credentials which are impersonation tokens,
+// so they can be told apart from signed tokens in stateless mode.
+const ImpersonationTokenPrefix = "gli_"
+
+var (
+	ErrTokenReused = errors.New("token reused")
 )
 
 type Token struct {
@@ -21,6 +37,37 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+	Family    string    `json:"-"`
+	// organization the token is bound to, 0 if none
+	OrganizationID int64 `json:"-"`
+	// user acting as UserID with an impersonation token, 0 otherwise
+	ImpersonatorID int64 `json:"-"`
+}
+
+// Session describes an authentication token as it is shown to its owner. It never
+// carries the token plaintext or hash, only the ID used to revoke it.
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Current    bool       `json:"current"`
+}
+
+// TokenMetadata describes any token of a user without its plaintext or hash, for
+// data exports.
+type TokenMetadata struct {
+	ID         int64      `json:"id"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) *Token {
@@ -43,6 +90,17 @@ func ValidateTokenPlainText(v *validator.Validator, tokenPlainText string) {
 	v.Check(len(tokenPlainText) == 26, "token", "must be 26 bytes long")
 }
 
+// IsImpersonationToken() reports whether a bearer credential is an impersonation
+// token.
+func IsImpersonationToken(plaintext string) bool {
+	return strings.HasPrefix(plaintext, ImpersonationTokenPrefix)
+}
+
+func ValidateImpersonationTokenPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(IsImpersonationToken(plaintext), "token", "must be an impersonation token")
+	v.Check(len(plaintext) == len(ImpersonationTokenPrefix)+26, "token", "must be 30 bytes long")
+}
+
 type TokenModel struct {
 	DB *sql.DB
 }
@@ -56,19 +114,176 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewForClient() works like New() but also records the token family, the
+// organization the token is bound to and the IP address and user agent of the
+// client the token is issued to. If family is empty, the token starts a new
+// family. If organizationID is 0, the token isn't bound to an organization.
+func (m TokenModel) NewForClient(userID int64, ttl time.Duration, scope, family string, organizationID int64, ip, userAgent string) (*Token, error) {
+	if family == "" {
+		family = rand.Text()
+	}
+
+	token := generateToken(userID, ttl, scope)
+	token.Family = family
+	token.OrganizationID = organizationID
+	token.IP = ip
+	token.UserAgent = userAgent
+
+	err := m.Insert(token)
+	return token, err
+}
+
+// NewImpersonation() issues a token with which impersonatorID acts as userID. The
+// IP address and user agent are those of the impersonator's client.
+func (m TokenModel) NewImpersonation(userID, impersonatorID int64, ttl time.Duration, ip, userAgent string) (*Token, error) {
+	token := generateToken(userID, ttl, ScopeImpersonation)
+	token.Plaintext = ImpersonationTokenPrefix + token.Plaintext
+	token.ImpersonatorID = impersonatorID
+	token.IP = ip
+	token.UserAgent = userAgent
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	err := m.Insert(token)
+	return token, err
+}
+
+// Rotate() exchanges a refresh token for a new refresh token in the same family,
+// bound to the same organization.
+// The old refresh token is kept but marked as rotated, so if it is ever presented
+// again the whole family is revoked and ErrTokenReused is returned.
+func (m TokenModel) Rotate(refreshTokenPlaintext string, ttl time.Duration, ip, userAgent string) (*Token, error) {
+	refreshHash := sha256.Sum256([]byte(refreshTokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT user_id, family, COALESCE(organization_id, 0), expiry, rotated_at
+		FROM tokens
+		WHERE hash = $1 AND scope = $2
+		FOR UPDATE`
+
+	var (
+		userID         int64
+		family         sql.NullString
+		organizationID int64
+		expiry         time.Time
+		rotatedAt      sql.NullTime
+	)
+
+	err = tx.QueryRowContext(ctx, query, refreshHash[:], ScopeRefresh).Scan(&userID, &family, &organizationID, &expiry, &rotatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// A refresh token that was already rotated is being replayed, which means it
+	// has leaked. Revoke every token in the family, including the ones issued to
+	// the legitimate client.
+	if rotatedAt.Valid {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, family.String)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrTokenReused
+	}
+
+	if !expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET rotated_at = $1 WHERE hash = $2`, time.Now(), refreshHash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	token := generateToken(userID, ttl, ScopeRefresh)
+	token.Family = family.String
+	token.OrganizationID = organizationID
+	token.IP = ip
+	token.UserAgent = userAgent
+
+	err = insertToken(ctx, tx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
 // Insert() adds the data for a specific token to the tokens table.
 func (m TokenModel) Insert(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertToken(ctx, m.DB, token)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertToken(ctx context.Context, db execer, token *Token) error {
 	query := `
-	INSERT INTO tokens (hash,user_id,expiry,scope)
-	VALUES ($1,$2,$3,$4)`
+	INSERT INTO tokens (hash,user_id,expiry,scope,ip,user_agent,family,organization_id,impersonator_id)
+	VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,''),NULLIF($8::bigint,0),NULLIF($9::bigint,0))`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.Family, token.OrganizationID, token.ImpersonatorID}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetOrganizationID() returns the ID of the organization a token is bound to, or 0
+// if it isn't bound to one.
+func (m TokenModel) GetOrganizationID(scope, tokenPlaintext string) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT COALESCE(organization_id, 0)
+		FROM tokens
+		WHERE hash = $1 AND scope = $2`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	var organizationID int64
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], scope).Scan(&organizationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return organizationID, nil
 }
 
 // DeleteAllForUser() deletes all tokens for a specific user and scope.
@@ -83,3 +298,266 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// Delete() removes a single token, identified by the hash of its plaintext, for
+// the given scope.
+func (m TokenModel) Delete(scope string, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, tokenHash[:], scope)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteFamily() removes a token together with every other token in its family,
+// so that revoking an authentication token also revokes the refresh token it was
+// issued with.
+func (m TokenModel) DeleteFamily(scope string, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		DELETE FROM tokens
+		WHERE (hash = $1 AND scope = $2)
+		OR family = (SELECT family FROM tokens WHERE hash = $1 AND scope = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, tokenHash[:], scope)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForFamily() removes every token in a token family.
+func (m TokenModel) DeleteAllForFamily(family string) error {
+	query := `
+		DELETE FROM tokens
+		WHERE family = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, family)
+	return err
+}
+
+// Touch() records that the token was used at the given time.
+func (m TokenModel) Touch(tokenPlaintext string, t time.Time) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		UPDATE tokens
+		SET last_used_at = $1
+		WHERE hash = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, t, tokenHash[:])
+	return err
+}
+
+// GetAllMetadataForUser() returns the metadata of every token of a user, in any
+// scope and including expired ones.
+func (m TokenModel) GetAllMetadataForUser(userID int64) ([]*TokenMetadata, error) {
+	query := `
+		SELECT id, scope, created_at, expiry, ip, user_agent, last_used_at
+		FROM tokens
+		WHERE user_id = $1
+		ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*TokenMetadata{}
+
+	for rows.Next() {
+		var token TokenMetadata
+
+		err := rows.Scan(
+			&token.ID,
+			&token.Scope,
+			&token.CreatedAt,
+			&token.Expiry,
+			&token.IP,
+			&token.UserAgent,
+			&token.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetSessionsForUser() returns the unexpired authentication tokens of a user as
+// sessions, newest first. The session matching currentTokenPlaintext is flagged
+// as the current one.
+func (m TokenModel) GetSessionsForUser(userID int64, currentTokenPlaintext string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+
+	query := `
+		SELECT id, created_at, expiry, ip, user_agent, last_used_at, hash = $1
+		FROM tokens
+		WHERE user_id = $2 AND scope = $3 AND expiry > $4
+		ORDER BY created_at DESC, id DESC`
+
+	args := []any{currentHash[:], userID, ScopeAuthentication, time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+			&session.LastUsedAt,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession() revokes a single authentication token of a user by its ID,
+// along with the rest of its token family.
+func (m TokenModel) DeleteSession(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $2
+		AND ((id = $1 AND scope = $3)
+		OR family = (SELECT family FROM tokens WHERE id = $1 AND user_id = $2 AND scope = $3))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID, ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired() deletes all tokens that expired before the given time and
+// returns how many were deleted, by scope.
+func (m TokenModel) DeleteExpired(before time.Time) (map[string]int64, error) {
+	query := `
+	WITH deleted AS (
+		DELETE FROM tokens
+		WHERE expiry < $1
+		RETURNING scope
+	)
+	SELECT scope, count(*)
+	FROM deleted
+	GROUP BY scope
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := make(map[string]int64)
+
+	for rows.Next() {
+		var scope string
+		var count int64
+
+		err := rows.Scan(&scope, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		deleted[scope] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/solomonsitotaw23/greenlight/internal/validator"
+)
+
+const recoveryCodeCount = 10
+
+// TwoFactor holds the TOTP enrollment of a user. Enabled is false between
+// enrollment and confirmation. LastStep is the time-step of the last code
+// accepted, which can't be used again.
+type TwoFactor struct {
+	UserID    int64
+	CreatedAt time.Time
+	Secret    []byte
+	Enabled   bool
+	LastStep  int64
+}
+
+// Validate a TOTP or recovery code supplied by a user
+func ValidateTwoFactorCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 32, "code", "must not be more than 32 bytes long")
+}
+
+// NormalizeRecoveryCode() strips the separators users may type in a recovery code
+// and upper-cases it.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ToUpper(code)
+}
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// get the TOTP enrollment of a user
+func (m TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+	SELECT user_id, created_at, secret, enabled, last_step
+	FROM users_totp
+	WHERE user_id = $1
+	`
+
+	var twoFactor TwoFactor
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.CreatedAt,
+		&twoFactor.Secret,
+		&twoFactor.Enabled,
+		&twoFactor.LastStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &twoFactor, nil
+}
+
+// IsEnabled() reports whether a user has confirmed TOTP two-factor authentication.
+func (m TwoFactorModel) IsEnabled(userID int64) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM users_totp WHERE user_id = $1 AND enabled)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var enabled bool
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// Enroll() stores a new, not yet confirmed, TOTP secret for a user, replacing any
+// previous unconfirmed one. It returns ErrEditConflict if two-factor
+// authentication is already enabled.
+func (m TwoFactorModel) Enroll(userID int64, secret []byte) error {
+	query := `
+	INSERT INTO users_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, created_at = NOW(), last_step = 0
+	WHERE users_totp.enabled = false
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Enable() confirms the enrollment of a user with the code of the given time-step
+// and replaces their recovery codes with a new set, which is returned in
+// plaintext. Only the hashes are stored.
+func (m TwoFactorModel) Enable(userID, step int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users_totp SET enabled = true, last_step = $2 WHERE user_id = $1`, userID, step)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		// 16 base32 characters, shown to the user as four groups of four
+		text := rand.Text()[:16]
+		codes[i] = text[:4] + "-" + text[4:8] + "-" + text[8:12] + "-" + text[12:]
+
+		hash := sha256.Sum256([]byte(text))
+		hashes[i] = hash[:]
+	}
+
+	query := `
+	INSERT INTO recovery_codes (hash, user_id)
+	SELECT unnest($1::bytea[]), $2
+	`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(hashes), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable() removes the TOTP enrollment and recovery codes of a user.
+func (m TwoFactorModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep() records that the code of a time-step was accepted, reporting false if
+// a code of the same or a later step was accepted in the meantime.
+func (m TwoFactorModel) UseStep(userID, step int64) (bool, error) {
+	query := `
+	UPDATE users_totp
+	SET last_step = $2
+	WHERE user_id = $1 AND last_step < $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode() consumes a recovery code of a user, reporting whether it was
+// valid. Each code can only be used once.
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	hash := sha256.Sum256([]byte(NormalizeRecoveryCode(code)))
+
+	query := `
+	DELETE FROM recovery_codes
+	WHERE hash = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hash[:], userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
@@ -5,10 +5,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/solomonsitotaw23/greenlight/internal/validator"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -24,50 +24,15 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Suspended bool      `json:"suspended"`
 	Version   int       `json:"-"`
 }
 
-type password struct {
-	plaintext *string
-	hash      []byte
-}
-
 // Check if the user is anonymous
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
-// The Set() method calculates the bcrypt hash of a plaintext password, and stores both
-// the hash and the plaintext versions in the struct.
-func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
-	if err != nil {
-		return err
-	}
-
-	p.plaintext = &plaintextPassword
-	p.hash = hash
-
-	return nil
-}
-
-// The Matches() method checks whether the provided plaintext password matches the
-// hashed password stored in the struct, returning true if it matches and false
-// otherwise.
-
-func (p *password) Matches(plaintextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
-	}
-	return true, nil
-}
-
 // Validator
 
 func ValidateEmail(v *validator.Validator, email string) {
@@ -75,10 +40,20 @@ func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
 }
 
+// ValidatePasswordPlaintext() checks a password supplied to prove who the user is.
+// Its upper bound doesn't depend on the configured algorithm, so passwords set
+// under another algorithm keep working.
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(len(password) <= maxPasswordLength, "password", fmt.Sprintf("must not be more than %d bytes long", maxPasswordLength))
+}
+
+// ValidateNewPasswordPlaintext() checks a password that is about to be set, which
+// must also fit the configured algorithm.
+func ValidateNewPasswordPlaintext(v *validator.Validator, password string) {
+	ValidatePasswordPlaintext(v, password)
+	v.Check(len(password) <= PasswordParams.MaxLength(), "password", fmt.Sprintf("must not be more than %d bytes long", PasswordParams.MaxLength()))
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
@@ -86,7 +61,8 @@ func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
 	ValidateEmail(v, user.Email)
 	if user.Password.plaintext != nil {
-		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+		ValidateNewPasswordPlaintext(v, *user.Password.plaintext)
+		ValidatePasswordStrength(v, *user.Password.plaintext, user.Name, user.Email)
 	}
 	if user.Password.hash == nil {
 		panic("missing password hash for user")
@@ -100,8 +76,8 @@ type UserModel struct {
 // insert user
 func (m UserModel) Insert(user *User) error {
 	query := `
-	INSERT INTO users (name,email,password_hash,activated)
-	VALUES ($1,$2,$3,$4)
+	INSERT INTO users (name,email,password_hash,activated,activated_at)
+	VALUES ($1,$2,$3,$4,CASE WHEN $4 THEN NOW() END)
 	RETURNING id,created_at,version
 	`
 
@@ -121,10 +97,47 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+// get user by id
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, suspended, version
+	FROM users
+	WHERE id = $1
+	`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 // get user by email address
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, name, email, password_hash, activated, version
+	SELECT id, created_at, name, email, password_hash, activated, suspended, version
 	FROM users
 	WHERE email = $1
 	`
@@ -139,6 +152,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Suspended,
 		&user.Version,
 	)
 
@@ -153,11 +167,95 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// check whether a user is suspended
+func (m UserModel) IsSuspended(id int64) (bool, error) {
+	query := `
+	SELECT suspended
+	FROM users
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var suspended bool
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&suspended)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return suspended, nil
+}
+
+// GetAll() returns a page of users whose name or email address contains search,
+// optionally narrowed down by status: "activated", "unactivated" or "suspended".
+func (m UserModel) GetAll(search, status string, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, email, activated, suspended, version
+	FROM users
+	WHERE (strpos(lower(name), lower($1)) > 0 OR strpos(lower(email::text), lower($1)) > 0 OR $1 = '')
+	AND ($2 = ''
+		OR ($2 = 'activated' AND activated AND NOT suspended)
+		OR ($2 = 'unactivated' AND NOT activated)
+		OR ($2 = 'suspended' AND suspended))
+	ORDER BY %s %s, id ASC
+	LIMIT $3 OFFSET $4
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{search, status, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Suspended,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
 func (m UserModel) Update(user *User) error {
 	query := `
 	UPDATE users
-	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET name = $1, email = $2, password_hash = $3, activated = $4, suspended = $5, version = version + 1,
+	activated_at = CASE WHEN $4 THEN coalesce(activated_at, NOW()) ELSE activated_at END
+	WHERE id = $6 AND version = $7
 	RETURNING version
 	`
 	args := []any{
@@ -165,6 +263,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Suspended,
 		user.ID,
 		user.Version,
 	}
@@ -186,11 +285,51 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// Delete() deletes a user, and through the foreign keys everything that belongs to
+// them, recording the deletion in account_deletions. Only the user ID and dates
+// are kept, no personal data.
+func (m UserModel) Delete(user *User, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO account_deletions (user_id, account_created_at, reason)
+	VALUES ($1, $2, $3)
+	`
+
+	_, err = tx.ExecContext(ctx, query, user.ID, user.CreatedAt, reason)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, user.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
 func (m UserModel) GetForToken(tokenScope, TokenPlainText string) (*User, error) {
 
 	tokenHash := sha256.Sum256([]byte(TokenPlainText))
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.version
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
@@ -211,6 +350,7 @@ func (m UserModel) GetForToken(tokenScope, TokenPlainText string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Suspended,
 		&user.Version,
 	)
 
@@ -226,3 +366,95 @@ func (m UserModel) GetForToken(tokenScope, TokenPlainText string) (*User, error)
 	return &user, nil
 
 }
+
+// GetForImpersonationToken() returns the user an unexpired impersonation token
+// acts as, together with the ID of the user acting as them.
+func (m UserModel) GetForImpersonationToken(tokenPlaintext string) (*User, int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.version, tokens.impersonator_id
+		FROM users
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND tokens.impersonator_id IS NOT NULL`
+
+	var (
+		user           User
+		impersonatorID int64
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeImpersonation, time.Now()).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+		&impersonatorID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, 0, ErrRecordNotFound
+		default:
+			return nil, 0, err
+		}
+	}
+
+	return &user, impersonatorID, nil
+}
+
+// DeleteUnactivated() deletes the users that registered before the cutoff but never
+// activated their account, recording each deletion like Delete() does, and
+// returns the IDs of the deleted users. Accounts deactivated by an administrator
+// were activated once, and are kept.
+func (m UserModel) DeleteUnactivated(cutoff time.Time) ([]int64, error) {
+	query := `
+	WITH deleted AS (
+		DELETE FROM users
+		WHERE activated = false AND activated_at IS NULL AND created_at < $1
+		RETURNING id, created_at
+	)
+	INSERT INTO account_deletions (user_id, account_created_at, reason)
+	SELECT id, created_at, 'never activated'
+	FROM deleted
+	RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,110 @@
+//go:build ignore
+
+// Generate merges password lists into common_passwords.txt.gz, the list embedded by
+// the data package. Each input is a newline-separated list, plain or gzipped, such
+// as the NCSC top 100k or the zxcvbn password list:
+//
+//	go run ./internal/data/wordlists/generate.go path/to/list.txt...
+//
+// The passwords already in the embedded list are kept. Passwords are lower-cased,
+// and those shorter than the minimum password length are dropped, since they can't
+// be chosen anyway.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// the minimum length enforced by data.ValidatePasswordPlaintext()
+const minLength = 8
+
+func main() {
+	out := flag.String("o", "internal/data/wordlists/common_passwords.txt.gz", "List to merge into")
+	flag.Parse()
+
+	passwords := make(map[string]bool)
+
+	for _, path := range append([]string{*out}, flag.Args()...) {
+		err := read(path, passwords)
+		if err != nil && !(path == *out && os.IsNotExist(err)) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	err := write(*out, passwords)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("wrote %d passwords to %s\n", len(passwords), *out)
+}
+
+func read(path string, passwords map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		password := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if len(password) >= minLength {
+			passwords[password] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+func write(path string, passwords map[string]bool) error {
+	sorted := make([]string, 0, len(passwords))
+	for password := range passwords {
+		sorted = append(sorted, password)
+	}
+	slices.Sort(sorted)
+
+	var buf bytes.Buffer
+
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	for _, password := range sorted {
+		fmt.Fprintln(zw, password)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
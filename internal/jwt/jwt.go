@@ -0,0 +1,180 @@
+// Package jwt implements signing and verification of compact JSON Web Tokens
+// using Ed25519 keys (the "EdDSA" algorithm). Keys are loaded from PEM files in a
+// directory, and the file name of each key is used as its key ID so that keys can
+// be rotated without invalidating tokens signed with an older key.
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// KeySet holds the private key used to sign new tokens and the public keys of
+// every key ID that is still accepted when verifying tokens.
+type KeySet struct {
+	signingKeyID string
+	signingKey   ed25519.PrivateKey
+	publicKeys   map[string]ed25519.PublicKey
+}
+
+// LoadKeySet() reads every "*.pem" file in dir. A file may contain either a PKCS #8
+// Ed25519 private key or a PKIX Ed25519 public key; the latter is useful to keep
+// verifying tokens signed by a retired key. The private key with the ID
+// signingKeyID is used for signing.
+func LoadKeySet(dir string, signingKeyID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{
+		signingKeyID: signingKeyID,
+		publicKeys:   make(map[string]ed25519.PublicKey),
+	}
+
+	for _, file := range files {
+		keyID := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(contents)
+		if block == nil {
+			return nil, fmt.Errorf("jwt: %s does not contain a PEM block", file)
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("jwt: %s: %w", file, err)
+			}
+			privateKey, ok := key.(ed25519.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("jwt: %s is not an Ed25519 key", file)
+			}
+			ks.publicKeys[keyID] = privateKey.Public().(ed25519.PublicKey)
+			if keyID == signingKeyID {
+				ks.signingKey = privateKey
+			}
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("jwt: %s: %w", file, err)
+			}
+			publicKey, ok := key.(ed25519.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("jwt: %s is not an Ed25519 key", file)
+			}
+			ks.publicKeys[keyID] = publicKey
+		default:
+			return nil, fmt.Errorf("jwt: %s contains an unsupported PEM block %q", file, block.Type)
+		}
+	}
+
+	if ks.signingKey == nil {
+		return nil, fmt.Errorf("jwt: no private key with ID %q found in %s", signingKeyID, dir)
+	}
+
+	return ks, nil
+}
+
+// Sign() encodes claims as the payload of a new token signed with the signing key.
+func (ks *KeySet) Sign(claims any) (string, error) {
+	h, err := json.Marshal(header{Algorithm: "EdDSA", Type: "JWT", KeyID: ks.signingKeyID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(ks.signingKey, []byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify() checks the signature and expiry of a token and decodes its payload into
+// dst. The payload must carry an "exp" claim.
+func (ks *KeySet) Verify(token string, dst any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	h, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	var hdr header
+	err = json.Unmarshal(h, &hdr)
+	if err != nil || hdr.Algorithm != "EdDSA" {
+		return ErrInvalidToken
+	}
+
+	publicKey, ok := ks.publicKeys[hdr.KeyID]
+	if !ok {
+		return ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	if !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	var registered struct {
+		ExpiresAt *int64 `json:"exp"`
+	}
+	err = json.Unmarshal(payload, &registered)
+	if err != nil || registered.ExpiresAt == nil {
+		return ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= *registered.ExpiresAt {
+		return ErrExpiredToken
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	err = dec.Decode(dst)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
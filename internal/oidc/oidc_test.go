@@ -0,0 +1,180 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/solomonsitotaw23/greenlight/internal/oidc"
+	"github.com/solomonsitotaw23/greenlight/internal/oidc/oidctest"
+)
+
+const (
+	clientID    = "greenlight"
+	redirectURL = "http://localhost:4000/v1/oidc/callback"
+)
+
+// authorize() runs the first half of the flow against the issuer and returns the
+// code it redirected back with.
+func authorize(t *testing.T, client *oidc.Client, state, nonce, verifier string) string {
+	t.Helper()
+
+	authURL, err := client.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	noRedirects := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	res, err := noRedirects.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: got status %d, want %d", res.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	if got := location.Query().Get("state"); got != state {
+		t.Fatalf("authorize: got state %q, want %q", got, state)
+	}
+
+	return location.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	issuer := oidctest.NewIssuer(clientID)
+	defer issuer.Close()
+
+	client := oidc.New(issuer.URL, clientID, "secret", redirectURL, []string{"openid", "email", "profile"})
+
+	verifier := oidc.NewVerifier()
+	code := authorize(t, client, "state", "nonce", verifier)
+
+	claims, err := client.Exchange(context.Background(), code, verifier, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if claims.Issuer != issuer.URL || claims.Subject != issuer.Subject || claims.Email != issuer.Email || !claims.EmailVerified || claims.Name != issuer.Name {
+		t.Errorf("got claims %+v", claims)
+	}
+
+	// codes can only be redeemed once
+	_, err = client.Exchange(context.Background(), code, verifier, "nonce")
+	if !errors.Is(err, oidc.ErrCodeRejected) {
+		t.Errorf("redeeming a code twice: got error %v, want %v", err, oidc.ErrCodeRejected)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	issuer := oidctest.NewIssuer(clientID)
+	defer issuer.Close()
+
+	client := oidc.New(issuer.URL, clientID, "", redirectURL, []string{"openid"})
+
+	code := authorize(t, client, "state", "nonce", oidc.NewVerifier())
+
+	_, err := client.Exchange(context.Background(), code, oidc.NewVerifier(), "nonce")
+	if !errors.Is(err, oidc.ErrCodeRejected) {
+		t.Errorf("got error %v, want %v", err, oidc.ErrCodeRejected)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	forgeryKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		nonce  string
+		tamper func(issuer *oidctest.Issuer)
+	}{
+		{
+			name:  "wrong audience",
+			nonce: "nonce",
+			tamper: func(issuer *oidctest.Issuer) {
+				issuer.Tamper = func(claims map[string]any) { claims["aud"] = "another-client" }
+			},
+		},
+		{
+			name:  "wrong issuer",
+			nonce: "nonce",
+			tamper: func(issuer *oidctest.Issuer) {
+				issuer.Tamper = func(claims map[string]any) { claims["iss"] = "https://evil.example.com" }
+			},
+		},
+		{
+			name:   "wrong nonce",
+			nonce:  "another-nonce",
+			tamper: func(issuer *oidctest.Issuer) {},
+		},
+		{
+			name:  "expired",
+			nonce: "nonce",
+			tamper: func(issuer *oidctest.Issuer) {
+				issuer.Tamper = func(claims map[string]any) { claims["exp"] = claims["iat"].(int64) - 3600 }
+			},
+		},
+		{
+			name:  "bad signature",
+			nonce: "nonce",
+			tamper: func(issuer *oidctest.Issuer) {
+				issuer.SigningKey = forgeryKey
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := oidctest.NewIssuer(clientID)
+			defer issuer.Close()
+
+			tt.tamper(issuer)
+
+			client := oidc.New(issuer.URL, clientID, "", redirectURL, []string{"openid"})
+
+			verifier := oidc.NewVerifier()
+			code := authorize(t, client, "state", "nonce", verifier)
+
+			_, err := client.Exchange(context.Background(), code, verifier, tt.nonce)
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Errorf("got error %v, want %v", err, oidc.ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	issuer := oidctest.NewIssuer(clientID)
+	defer issuer.Close()
+
+	// the same server under another name
+	_, port, err := net.SplitHostPort(issuer.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := "http://localhost:" + port
+
+	client := oidc.New(other, clientID, "", redirectURL, []string{"openid"})
+
+	_, err = client.AuthCodeURL(context.Background(), "state", "nonce", oidc.NewVerifier())
+	if err == nil {
+		t.Error("expected discovery to fail when the issuer doesn't match its URL")
+	}
+}
@@ -0,0 +1,251 @@
+// Package oidctest provides a minimal OpenID Connect provider for testing relying
+// parties: discovery, a JSON Web Key Set, an authorization endpoint that approves
+// every request, and a token endpoint that enforces PKCE and issues RS256 signed ID
+// tokens.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const keyID = "oidctest"
+
+// Issuer is a mock provider listening on a local HTTP server. Its fields may be
+// changed between requests to make it misbehave.
+type Issuer struct {
+	*httptest.Server
+
+	// ClientID is the only client accepted by the token endpoint.
+	ClientID string
+
+	// Subject, Email and Name identify the user who approves every authorization.
+	Subject string
+	Email   string
+	Name    string
+
+	// SigningKey signs the ID tokens. It starts out as the key published in the
+	// key set; replacing it produces tokens with invalid signatures.
+	SigningKey *rsa.PrivateKey
+
+	// Tamper, if set, may change the claims of an ID token before it is signed.
+	Tamper func(claims map[string]any)
+
+	publicKey *rsa.PublicKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// an approved authorization request waiting for its code to be redeemed
+type authorization struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// NewIssuer() starts a mock provider for the given client. Callers should call
+// Close() when done.
+func NewIssuer(clientID string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("oidctest: generating key: " + err.Error())
+	}
+
+	issuer := &Issuer{
+		ClientID:   clientID,
+		Subject:    "user-1",
+		Email:      "alice@example.com",
+		Name:       "Alice",
+		SigningKey: key,
+		publicKey:  &key.PublicKey,
+		codes:      make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discoveryHandler)
+	mux.HandleFunc("GET /jwks", issuer.jwksHandler)
+	mux.HandleFunc("GET /authorize", issuer.authorizeHandler)
+	mux.HandleFunc("POST /token", issuer.tokenHandler)
+
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+func (i *Issuer) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(i.publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+// authorizeHandler() approves the request straight away and redirects back to the
+// client with a code.
+func (i *Issuer) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	if qs.Get("response_type") != "code" || qs.Get("code_challenge_method") != "S256" || qs.Get("code_challenge") == "" {
+		http.Error(w, "unsupported authorization request", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(qs.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+
+	i.mu.Lock()
+	i.codes[code] = authorization{
+		clientID:    qs.Get("client_id"),
+		redirectURI: qs.Get("redirect_uri"),
+		challenge:   qs.Get("code_challenge"),
+		nonce:       qs.Get("nonce"),
+	}
+	i.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", qs.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// tokenHandler() redeems a code once, provided the client, redirect URI and PKCE
+// verifier match the authorization request.
+func (i *Issuer) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if username, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(username)
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	if clientID != i.ClientID {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	i.mu.Lock()
+	auth, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	if !ok || auth.clientID != clientID || auth.redirectURI != r.PostForm.Get("redirect_uri") ||
+		auth.challenge != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	idToken, err := i.IDToken(auth.nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// IDToken() returns an ID token for the issuer's user with the given nonce, signed
+// with SigningKey after Tamper has been applied.
+func (i *Issuer) IDToken(nonce string) (string, error) {
+	now := time.Now()
+
+	claims := map[string]any{
+		"iss":            i.URL,
+		"sub":            i.Subject,
+		"aud":            i.ClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          i.Email,
+		"email_verified": true,
+		"name":           i.Name,
+	}
+
+	if i.Tamper != nil {
+		i.Tamper(claims)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.SigningKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
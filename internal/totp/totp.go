@@ -0,0 +1,95 @@
+// Package totp implements time-based one-time passwords as described in RFC 6238,
+// using the defaults understood by common authenticator apps: HMAC-SHA1, 6 digits
+// and a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	digits = 6
+	period = 30
+	// number of periods before and after the current one in which a code is
+	// still accepted, to allow for clock drift
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret() returns a new random 160-bit shared secret.
+func GenerateSecret() []byte {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return secret
+}
+
+// EncodeSecret() returns the base32 form of a secret that users can type into an
+// authenticator app.
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// URI() returns the otpauth:// URI for a secret, usually shown as a QR code.
+func URI(issuer, account string, secret []byte) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(digits))
+	params.Set("period", fmt.Sprint(period))
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Validate() reports whether code is the valid one-time password for secret at
+// time t, and returns the time-step it belongs to. Codes of time-steps up to and
+// including after are rejected, so passing the step of the last accepted code
+// prevents a code from being used twice.
+func Validate(secret []byte, code string, t time.Time, after int64) (int64, bool) {
+	if len(code) != digits {
+		return 0, false
+	}
+
+	counter := t.Unix() / period
+
+	// from the newest step, in case two steps share a code
+	for i := int64(skew); i >= -skew; i-- {
+		step := counter + i
+		if step <= after {
+			break
+		}
+
+		expected := generate(secret, uint64(step))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// generate() computes the HOTP value (RFC 4226) of secret for counter.
+func generate(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", digits, value%1_000_000)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS failed_logins;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS failed_logins (
+id bigserial PRIMARY KEY,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+email citext NOT NULL,
+ip text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS failed_logins_email_idx ON failed_logins (email, created_at);
+CREATE INDEX IF NOT EXISTS failed_logins_ip_idx ON failed_logins (ip, created_at);
+CREATE TABLE IF NOT EXISTS login_lockouts (
+email citext PRIMARY KEY,
+locked_until timestamp(0) with time zone NOT NULL
+);
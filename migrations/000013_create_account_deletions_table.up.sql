@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS account_deletions (
+id bigserial PRIMARY KEY,
+user_id bigint NOT NULL,
+account_created_at timestamp(0) with time zone NOT NULL,
+deleted_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+reason text NOT NULL
+);
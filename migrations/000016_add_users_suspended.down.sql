@@ -0,0 +1,7 @@
+UPDATE roles
+SET description = 'Can browse and edit movies and manage roles'
+WHERE name = 'admin';
+
+DELETE FROM permissions WHERE code = 'users:admin';
+
+ALTER TABLE users DROP COLUMN IF EXISTS suspended;
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended boolean NOT NULL DEFAULT false;
+
+INSERT INTO permissions (code)
+VALUES
+('users:admin');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'users:admin'
+ON CONFLICT DO NOTHING;
+
+UPDATE roles
+SET description = 'Can browse and edit movies and manage users and roles'
+WHERE name = 'admin';
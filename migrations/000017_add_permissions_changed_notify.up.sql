@@ -0,0 +1,31 @@
+-- Announce changes to grants on the permissions_changed channel, so that every API
+-- instance can drop the cached permissions of the affected users.
+CREATE OR REPLACE FUNCTION notify_user_permissions_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('permissions_changed', OLD.user_id::text);
+    ELSE
+        PERFORM pg_notify('permissions_changed', NEW.user_id::text);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_role_permissions_changed() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('permissions_changed', '*');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_permissions_notify
+AFTER INSERT OR UPDATE OR DELETE ON users_permissions
+FOR EACH ROW EXECUTE FUNCTION notify_user_permissions_changed();
+
+CREATE TRIGGER users_roles_notify
+AFTER INSERT OR UPDATE OR DELETE ON users_roles
+FOR EACH ROW EXECUTE FUNCTION notify_user_permissions_changed();
+
+CREATE TRIGGER roles_permissions_notify
+AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON roles_permissions
+FOR EACH STATEMENT EXECUTE FUNCTION notify_role_permissions_changed();
@@ -0,0 +1,14 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS movies_created_by_idx ON movies (created_by);
+
+-- Holders of movies:admin may change movies they didn't create.
+INSERT INTO permissions (code)
+VALUES
+('movies:admin');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'movies:admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,11 @@
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+
+-- The codes are synced from the registry in the application, which relies on them
+-- being unique.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_constraint WHERE conname = 'permissions_code_key' AND conrelid = 'permissions'::regclass) THEN
+        ALTER TABLE permissions ADD CONSTRAINT permissions_code_key UNIQUE (code);
+    END IF;
+END
+$$;
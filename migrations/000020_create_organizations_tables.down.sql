@@ -0,0 +1,7 @@
+ALTER TABLE api_keys DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE tokens DROP COLUMN IF EXISTS organization_id;
+DROP INDEX IF EXISTS movies_organization_id_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organization_members_permissions;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
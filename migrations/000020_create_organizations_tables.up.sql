@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS organizations (
+id bigserial PRIMARY KEY,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL,
+slug citext UNIQUE NOT NULL,
+version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_members_permissions (
+organization_id bigint NOT NULL,
+user_id bigint NOT NULL,
+permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+PRIMARY KEY (organization_id, user_id, permission_id),
+FOREIGN KEY (organization_id, user_id) REFERENCES organization_members ON DELETE CASCADE
+);
+
+-- Existing movies and users move to a default organization. New users only join it
+-- if the API's -default-organization flag names it.
+INSERT INTO organizations (name, slug)
+VALUES ('Default', 'default');
+
+INSERT INTO organization_members (organization_id, user_id)
+SELECT organizations.id, users.id
+FROM organizations, users
+WHERE organizations.slug = 'default';
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS organization_id bigint REFERENCES organizations ON DELETE CASCADE;
+UPDATE movies SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+ALTER TABLE movies ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS movies_organization_id_idx ON movies (organization_id);
+
+-- Tokens and API keys can be bound to an organization.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS organization_id bigint REFERENCES organizations ON DELETE CASCADE;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS organization_id bigint REFERENCES organizations ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'users:impersonate';
+
+DROP TABLE IF EXISTS audit_events;
+
+DELETE FROM tokens WHERE impersonator_id IS NOT NULL;
+ALTER TABLE tokens DROP COLUMN IF EXISTS impersonator_id;
@@ -0,0 +1,26 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS impersonator_id bigint REFERENCES users ON DELETE CASCADE;
+
+-- The audit trail outlives the users it mentions.
+CREATE TABLE IF NOT EXISTS audit_events (
+id bigserial PRIMARY KEY,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+actor_id bigint REFERENCES users ON DELETE SET NULL,
+user_id bigint REFERENCES users ON DELETE SET NULL,
+action text NOT NULL,
+details text NOT NULL DEFAULT '',
+ip text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS audit_events_user_id_idx ON audit_events (user_id);
+
+INSERT INTO permissions (code, description)
+VALUES
+('users:impersonate', 'Act as another user with an impersonation token')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'users:impersonate'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM movies WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS movies_deleted_at_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+version integer NOT NULL,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+created_by bigint REFERENCES users ON DELETE SET NULL,
+title text NOT NULL,
+year integer NOT NULL,
+runtime integer NOT NULL,
+genres text[] NOT NULL,
+PRIMARY KEY (movie_id, version)
+);
+
+-- Earlier versions are lost, so the history of existing movies starts with their
+-- current version. Who made it is only known for movies that were never edited.
+INSERT INTO movie_revisions (movie_id, version, created_at, created_by, title, year, runtime, genres)
+SELECT id, version, created_at, CASE WHEN version = 1 THEN created_by END, title, year, runtime, genres
+FROM movies
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS activated_at timestamp(0) with time zone;
+
+-- When existing accounts were activated isn't known, so they count as activated
+-- when they were created.
+UPDATE users SET activated_at = created_at WHERE activated AND activated_at IS NULL;
@@ -0,0 +1,10 @@
+INSERT INTO permissions (code, description)
+VALUES
+('metrics:view', 'Read the runtime metrics at /debug/vars')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'metrics:view'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+-- The time-step of the last accepted code, so that no code is accepted twice.
+ALTER TABLE users_totp ADD COLUMN IF NOT EXISTS last_step bigint NOT NULL DEFAULT 0;
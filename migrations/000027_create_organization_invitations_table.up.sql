@@ -0,0 +1,13 @@
+-- Users only join an organization by accepting an invitation, so organization
+-- admins can't add anyone without their consent.
+CREATE TABLE IF NOT EXISTS organization_invitations (
+organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+invited_by bigint REFERENCES users ON DELETE SET NULL,
+permissions text[] NOT NULL,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+expiry timestamp(0) with time zone NOT NULL,
+PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_user_id_idx ON organization_invitations (user_id);